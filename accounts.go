@@ -0,0 +1,154 @@
+package auth0cliauthorizer
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+type Account struct {
+	User            User      `json:"user"`
+	Active          bool      `json:"active"`
+	ExpiresAt       time.Time `json:"expires_at"`
+	HasRefreshToken bool      `json:"has_refresh_token"`
+}
+
+// ListAccounts returns the accounts cached for this tenant, the active one first.
+func (a *DefaultImpl) ListAccounts() ([]Account, error) {
+	accounts, err := a.accountStore()
+	if err != nil {
+		return nil, err
+	}
+
+	stored, err := accounts.ListAccounts()
+	if err != nil {
+		return nil, errors.Wrap(err, "error listing the accounts from store")
+	}
+
+	active, err := a.store.Load()
+	if err != nil {
+		return nil, errors.Wrap(err, "error loading the active account from store")
+	}
+
+	result := make([]Account, 0, len(stored))
+	for _, authentication := range stored {
+		result = append(result, Account{
+			User:            authentication.User,
+			Active:          active != nil && active.User.Sub == authentication.User.Sub,
+			ExpiresAt:       authentication.Tokens.ExpiresAt,
+			HasRefreshToken: authentication.Tokens.RefreshToken != "",
+		})
+	}
+	return result, nil
+}
+
+// AddAccount starts a new device flow regardless of the cached authentication.
+// The new account becomes the active one, the previous one is kept for SwitchAccount.
+func (a *DefaultImpl) AddAccount(ctx context.Context) (Authentication, error) {
+	if _, err := a.accountStore(); err != nil {
+		return Authentication{}, err
+	}
+	return a.authorize(ctx, false)
+}
+
+// SwitchAccount makes the cached account with the given subject the active one,
+// refreshing its tokens if needed.
+func (a *DefaultImpl) SwitchAccount(ctx context.Context, sub string) (Authentication, error) {
+	accounts, err := a.accountStore()
+	if err != nil {
+		return Authentication{}, err
+	}
+
+	if err = accounts.ActivateAccount(sub); err != nil {
+		return Authentication{}, errors.Wrap(err, "error switching account")
+	}
+
+	loaded, err := a.loadFromStore(ctx)
+	if err != nil {
+		return Authentication{}, errors.Wrap(err, "error loading the account from store")
+	}
+	if loaded == nil {
+		return Authentication{}, ErrAccountNotFound
+	}
+
+	return *loaded, nil
+}
+
+// LogoutAccount works like Logout for a single cached account, active or not.
+func (a *DefaultImpl) LogoutAccount(ctx context.Context, sub string) error {
+	accounts, err := a.accountStore()
+	if err != nil {
+		return err
+	}
+
+	var revocationErr error
+	if a.revokeOnLogout {
+		stored, err := accounts.ListAccounts()
+		if err != nil {
+			revocationErr = &RevocationError{Err: errors.Wrap(err, "error loading the refresh token to revoke")}
+		}
+		for i := range stored {
+			if stored[i].User.Sub == sub {
+				revocationErr = a.revokeAuthentication(ctx, &stored[i])
+				break
+			}
+		}
+	}
+
+	if err = accounts.ClearAccount(sub); err != nil {
+		return errors.Wrap(err, "error removing the account from store")
+	}
+
+	return revocationErr
+}
+
+// LogoutAllAccounts works like Logout for every cached account of this tenant,
+// the parked ones too. It is the same as Logout with a store that holds a single account.
+func (a *DefaultImpl) LogoutAllAccounts(ctx context.Context) error {
+	accounts, ok := a.store.(accountStore)
+	if !ok {
+		return a.Logout(ctx)
+	}
+
+	stored, err := accounts.ListAccounts()
+	if err != nil {
+		return errors.Wrap(err, "error listing the accounts from store")
+	}
+
+	var revocationErr error
+	for i := range stored {
+		if a.revokeOnLogout {
+			if err = a.revokeAuthentication(ctx, &stored[i]); err != nil && revocationErr == nil {
+				revocationErr = err
+			}
+		}
+		if stored[i].User.Sub != "" {
+			if err = accounts.ClearAccount(stored[i].User.Sub); err != nil {
+				return errors.Wrap(err, "error removing the account from store")
+			}
+		}
+	}
+
+	a.clearPendingFlow()
+	if err = a.store.Clear(); err != nil {
+		return errors.Wrap(err, "error removing authentication info from store")
+	}
+
+	if a.browserLogout {
+		a.logoutBrowserSession(ctx)
+	}
+
+	return revocationErr
+}
+
+func (a *DefaultImpl) accountStore() (accountStore, error) {
+	if a.store == nil {
+		return nil, errors.New("missing store implementation")
+	}
+	accounts, ok := a.store.(accountStore)
+	if !ok {
+		return nil, ErrAccountsNotSupported
+	}
+	return accounts, nil
+}
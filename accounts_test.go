@@ -0,0 +1,55 @@
+package auth0cliauthorizer
+
+import (
+	"context"
+	"os"
+	"sort"
+	"testing"
+)
+
+func TestManagerLogoutAllRemovesParkedAccounts(t *testing.T) {
+	f := newFakeAuth0(t)
+	dir := t.TempDir()
+
+	manager, err := NewManager([]Profile{
+		{Name: "dev", Domain: f.srv.URL, ClientID: "client", Audience: "https://api", Store: ProfileStore{Dir: dir}},
+	}, WithLogger(nil), WithAutoOpenBrowser(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err := manager.Authorizer("dev")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"alice", "bob"} {
+		err = a.store.Save(Authentication{
+			User:   User{Sub: "auth0|" + name, Email: name + "@example.com"},
+			Tokens: Tokens{AccessToken: "access-" + name, RefreshToken: "refresh-" + name},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if accounts, err := a.ListAccounts(); err != nil || len(accounts) != 2 {
+		t.Fatalf("expected two accounts, got %v, %v", accounts, err)
+	}
+
+	if err = manager.LogoutAll(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	revoked := f.revokedTokens()
+	sort.Strings(revoked)
+	if len(revoked) != 2 || revoked[0] != "refresh-alice" || revoked[1] != "refresh-bob" {
+		t.Fatalf("expected both refresh tokens to be revoked, got %v", revoked)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range entries {
+		t.Errorf("unexpected file left in the store: %s", entry.Name())
+	}
+}
@@ -14,18 +14,35 @@ const (
 	scopeOfflineAccess = "offline_access"
 )
 
-func (a *DefaultImpl) getDeviceCode(ctx context.Context) (deviceCodeResponseDTO, error) {
-	a.logger.Debug("requesting a device code")
-
+func (a *DefaultImpl) effectiveScopes() string {
 	scopes := defaultScopes
-	if a.requireOfflineAccess {
+	if len(a.scopes) > 0 {
+		scopes = strings.Join(a.scopes, " ")
+	}
+	if a.requireOfflineAccess && !hasScope(scopes, scopeOfflineAccess) {
 		scopes += " " + scopeOfflineAccess
 	}
+	return scopes
+}
+
+func hasScope(scopes, scope string) bool {
+	for _, s := range strings.Fields(scopes) {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+func (a *DefaultImpl) getDeviceCode(ctx context.Context) (deviceCodeResponseDTO, error) {
+	a.logger.Debug("requesting a device code")
 
 	data := url.Values{}
 	data.Set("client_id", a.clientID)
-	data.Set("audience", a.audience)
-	data.Set("scope", scopes)
+	if a.audience != "" {
+		data.Set("audience", a.audience)
+	}
+	data.Set("scope", a.effectiveScopes())
 
 	req, err := http.NewRequestWithContext(
 		ctx,
@@ -141,3 +158,27 @@ func (a *DefaultImpl) getTokenFromRefreshToken(ctx context.Context, refreshToken
 
 	return deserialized, nil
 }
+
+func (a *DefaultImpl) revokeRefreshToken(ctx context.Context, refreshToken string) error {
+	return a.revokeRefreshTokenOn(ctx, a.domain, a.clientID, refreshToken)
+}
+
+// revokeRefreshTokenOn allows revoking tokens issued to other tenants, as found in the store.
+func (a *DefaultImpl) revokeRefreshTokenOn(ctx context.Context, domain *url.URL, clientID, refreshToken string) error {
+
+	data := url.Values{}
+	data.Set("client_id", clientID)
+	data.Set("token", refreshToken)
+
+	req, err := http.NewRequestWithContext(
+		ctx,
+		http.MethodPost,
+		joinURL(domain, "oauth/revoke"),
+		strings.NewReader(data.Encode()),
+	)
+	if err != nil {
+		return errors.Wrap(err, "error creating HTTP request")
+	}
+
+	return a.doWithClient(req, nil)
+}
@@ -2,43 +2,114 @@ package auth0cliauthorizer
 
 import (
 	"context"
+	"crypto/rsa"
 	"net/url"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/golang-jwt/jwt/v4"
-	"github.com/pkg/browser"
 	"github.com/pkg/errors"
 )
 
 type Authorizer interface {
 	Authorize(ctx context.Context) (Authentication, error)
 	Refresh(ctx context.Context, refreshToken string) (Authentication, error)
-	Logout() error
+	Logout(ctx context.Context) error
 }
 
 type DefaultImpl struct {
 	domain                      *url.URL
 	clientID                    string
 	audience                    string
+	scopes                      []string
 	prefillDeviceCode           bool
 	requireOfflineAccess        bool
+	revokeOnLogout              bool
+	browserLogout               bool
+	browserLogoutReturnTo       string
 	autoOpenBrowser             bool
+	headlessDetection           bool
+	browserOpener               BrowserOpener
 	httpClientCustomizer        HTTPClientCustomizer
 	deviceConfirmPromptCallback DeviceConfirmPromptCallback
+	pollingProgressCallback     PollingProgressCallback
 	storeBuilder                storeBuilder
 	storeRestoreMinDuration     time.Duration
-	store                       store
+	store                       Store
+	secureStoreFactory          StoreFactory
+	hostBinding                 bool
+	accessTokenDecryptionKey    *rsa.PrivateKey
+	housekeepingPolicy          *HousekeepingPolicy
+	housekeepingRunning         int32
+	housekeepingDone            sync.WaitGroup
+	progressWriter              *jsonProgressWriter
 	logger                      *loggerWrapper
 }
 
 var _ Authorizer = &DefaultImpl{}
 
-func (a *DefaultImpl) Logout() error {
-	if a.store != nil {
-		if err := a.store.Clear(); err != nil {
-			return errors.Wrap(err, "error removing authentication info from store")
+// pending device flows expiring sooner than this are not worth resuming
+const minPendingFlowDuration = 30 * time.Second
+
+// Logout revokes the stored refresh token of the active account and clears it from the store.
+// Local cleanup happens even if the revocation fails: in that case a *RevocationError is returned.
+// The accounts parked by AddAccount are left, use LogoutAllAccounts to end them too.
+func (a *DefaultImpl) Logout(ctx context.Context) error {
+	if a.store == nil {
+		if a.browserLogout {
+			a.logoutBrowserSession(ctx)
 		}
+		return nil
+	}
+
+	var revocationErr error
+	if a.revokeOnLogout {
+		revocationErr = a.revokeStoredRefreshToken(ctx)
+	}
+
+	a.clearPendingFlow()
+	if err := a.store.Clear(); err != nil {
+		return errors.Wrap(err, "error removing authentication info from store")
+	}
+
+	if a.browserLogout {
+		a.logoutBrowserSession(ctx)
+	}
+
+	return revocationErr
+}
+
+func (a *DefaultImpl) logoutBrowserSession(ctx context.Context) {
+	logoutURL := a.browserLogoutURL()
+
+	if err := a.openURL(ctx, logoutURL); err != nil {
+		a.logger.Warningf("could not end the browser session, open %s to do it manually: %v", logoutURL, err)
+		return
+	}
+
+	a.logger.Debug("opened the browser to end the Auth0 session")
+}
+
+func (a *DefaultImpl) revokeStoredRefreshToken(ctx context.Context) error {
+	loaded, err := a.store.Load()
+	if err != nil {
+		return &RevocationError{Err: errors.Wrap(err, "error loading the refresh token to revoke")}
+	}
+	return a.revokeAuthentication(ctx, loaded)
+}
+
+func (a *DefaultImpl) revokeAuthentication(ctx context.Context, authentication *Authentication) error {
+	if authentication == nil || authentication.Tokens.RefreshToken == "" {
+		a.logger.Debug("no refresh token to revoke")
+		return nil
+	}
+
+	if err := a.revokeRefreshToken(ctx, authentication.Tokens.RefreshToken); err != nil {
+		return &RevocationError{Err: err}
 	}
+
+	a.logger.Debug("refresh token was revoked")
 	return nil
 }
 
@@ -59,34 +130,106 @@ func (a *DefaultImpl) authorize(ctx context.Context, loadFromStore bool) (Authen
 			a.logger.Debug("no authentication available from store")
 		} else {
 			a.logger.Debug("loaded cached authentication from store")
+			a.emitProgress(ProgressEvent{
+				Type:  ProgressEventSuccess,
+				Email: loaded.User.Email,
+			})
 			return *loaded, nil
 		}
 	}
 
-	deviceCodeResponse, err := a.getDeviceCode(ctx)
+	authentication, err := a.runDeviceFlow(ctx)
 	if err != nil {
-		return Authentication{}, errors.Wrap(err, "error fetching the device code")
+		a.emitProgress(failureProgressEvent(err))
+		return Authentication{}, err
+	}
+
+	a.emitProgress(ProgressEvent{
+		Type:  ProgressEventSuccess,
+		Email: authentication.User.Email,
+	})
+
+	if a.store != nil {
+		err = a.store.Save(authentication)
+		if err != nil {
+			a.logger.Errorf("error storing authentication in store: %v", err)
+		} else {
+			a.opportunisticHousekeeping()
+		}
+	}
+
+	return authentication, nil
+}
+
+func (a *DefaultImpl) runDeviceFlow(ctx context.Context) (Authentication, error) {
+	deviceCodeResponse, resumed := a.loadPendingFlow()
+	if resumed {
+		tokenResponse, err := a.getTokenFromDeviceCode(ctx, deviceCodeResponse.DeviceCode)
+		switch {
+		case err == nil:
+			a.logger.Debug("pending device flow was already confirmed")
+			a.clearPendingFlow()
+			return a.authenticationFromTokenResponse(ctx, tokenResponse)
+		case ctx.Err() != nil:
+			return Authentication{}, ctx.Err()
+		case err == errAuthorizationPending || err == errSlowDown:
+			a.logger.Debug("resuming pending device flow")
+		default:
+			a.logger.Debugf("pending device flow can not be resumed (%v)", err)
+			a.clearPendingFlow()
+			resumed = false
+		}
+	}
+
+	var err error
+	if !resumed {
+		deviceCodeResponse, err = a.getDeviceCode(ctx)
+		if err != nil {
+			return Authentication{}, errors.Wrap(err, "error fetching the device code")
+		}
+		a.savePendingFlow(deviceCodeResponse)
 	}
 
-	if a.autoOpenBrowser {
+	expiresAt := time.Now().Add(time.Second * time.Duration(deviceCodeResponse.ExpiresIn))
+
+	a.emitProgress(ProgressEvent{
+		Type:                    ProgressEventDeviceCodeIssued,
+		UserCode:                deviceCodeResponse.UserCode,
+		VerificationUri:         deviceCodeResponse.VerificationUri,
+		VerificationUriComplete: deviceCodeResponse.VerificationUriComplete,
+		ExpiresIn:               deviceCodeResponse.ExpiresIn,
+		ExpiresAt:               &expiresAt,
+	})
+
+	browserOpened := false
+	if a.autoOpenBrowser && !resumed {
 		toOpen := deviceCodeResponse.VerificationUriComplete
 		if !a.prefillDeviceCode {
 			toOpen = deviceCodeResponse.VerificationUri
 		}
-		err = browser.OpenURL(toOpen)
-		if err != nil {
-			return Authentication{}, errors.Wrap(err, "error opening browser window")
-		}
+		browserOpened = a.openBrowser(ctx, toOpen)
 	}
 
-	if a.deviceConfirmPromptCallback != nil {
-		err = a.deviceConfirmPromptCallback(DeviceConfirmPrompt{
-			DeviceCode:              deviceCodeResponse.DeviceCode,
-			VerificationUri:         deviceCodeResponse.VerificationUri,
-			VerificationUriComplete: deviceCodeResponse.VerificationUriComplete,
-			ExpiresIn:               deviceCodeResponse.ExpiresIn,
-		})
+	prompt := DeviceConfirmPrompt{
+		DeviceCode:              deviceCodeResponse.DeviceCode,
+		UserCode:                deviceCodeResponse.UserCode,
+		VerificationUri:         deviceCodeResponse.VerificationUri,
+		VerificationUriComplete: deviceCodeResponse.VerificationUriComplete,
+		ExpiresIn:               deviceCodeResponse.ExpiresIn,
+		ExpiresAt:               expiresAt,
+		outcome:                 newPromptOutcome(a.logger),
+	}
+
+	promptCallback := a.deviceConfirmPromptCallback
+	if promptCallback == nil && a.autoOpenBrowser && !browserOpened && a.progressWriter == nil {
+		a.logger.Debug("browser window was not opened, falling back to the terminal prompt")
+		promptCallback = NewTerminalPrompt(nil)
+	}
+
+	if promptCallback != nil {
+		err = promptCallback(prompt)
 		if err != nil {
+			prompt.outcome.complete(err)
 			return Authentication{}, err
 		}
 	}
@@ -95,22 +238,120 @@ func (a *DefaultImpl) authorize(ctx context.Context, loadFromStore bool) (Authen
 
 	tokenResponse, err := a.pollForToken(ctx, deviceCodeResponse.DeviceCode, pollingInterval)
 	if err != nil {
-		return Authentication{}, errors.Wrap(err, "error waiting for authorization")
+		if ctx.Err() == nil {
+			a.clearPendingFlow()
+		}
+		err = errors.Wrap(err, "error waiting for authorization")
+		prompt.outcome.complete(err)
+		return Authentication{}, err
 	}
 
-	authentication, err := a.buildAuthentication(ctx, tokenResponse.AccessToken, tokenResponse.IdToken, tokenResponse.RefreshToken)
+	a.clearPendingFlow()
+
+	authentication, err := a.authenticationFromTokenResponse(ctx, tokenResponse)
+	prompt.outcome.complete(err)
+	return authentication, err
+}
+
+func (a *DefaultImpl) authenticationFromTokenResponse(ctx context.Context, tokenResponse tokenResponseDTO) (Authentication, error) {
+	authentication, err := a.buildAuthentication(ctx, tokenResponse.AccessToken, tokenResponse.IdToken, tokenResponse.RefreshToken, tokenResponse.ExpiresIn)
 	if err != nil {
 		return Authentication{}, errors.Wrap(err, "error building authentication")
 	}
 
-	if a.store != nil {
-		err = a.store.Save(authentication)
-		if err != nil {
-			a.logger.Errorf("error storing authentication in store: %v", err)
+	return authentication, nil
+}
+
+func (a *DefaultImpl) loadPendingFlow() (deviceCodeResponseDTO, bool) {
+	pendingStore, ok := a.store.(pendingFlowStore)
+	if !ok {
+		return deviceCodeResponseDTO{}, false
+	}
+
+	pending, err := pendingStore.LoadPendingFlow()
+	if err != nil {
+		a.logger.Warningf("failed to load pending device flow from store: %v", err)
+		return deviceCodeResponseDTO{}, false
+	}
+	if pending == nil {
+		return deviceCodeResponseDTO{}, false
+	}
+
+	expiresIn := time.Until(pending.ExpiresAt)
+	if expiresIn < minPendingFlowDuration {
+		a.logger.Debug("pending device flow in store is expired")
+		a.clearPendingFlow()
+		return deviceCodeResponseDTO{}, false
+	}
+
+	return deviceCodeResponseDTO{
+		DeviceCode:              pending.DeviceCode,
+		UserCode:                pending.UserCode,
+		VerificationUri:         pending.VerificationUri,
+		VerificationUriComplete: pending.VerificationUriComplete,
+		ExpiresIn:               int(expiresIn.Seconds()),
+		Interval:                pending.Interval,
+	}, true
+}
+
+func (a *DefaultImpl) savePendingFlow(deviceCodeResponse deviceCodeResponseDTO) {
+	pendingStore, ok := a.store.(pendingFlowStore)
+	if !ok {
+		return
+	}
+
+	err := pendingStore.SavePendingFlow(pendingDeviceFlow{
+		DeviceCode:              deviceCodeResponse.DeviceCode,
+		UserCode:                deviceCodeResponse.UserCode,
+		VerificationUri:         deviceCodeResponse.VerificationUri,
+		VerificationUriComplete: deviceCodeResponse.VerificationUriComplete,
+		Interval:                deviceCodeResponse.Interval,
+		ExpiresAt:               time.Now().Add(time.Second * time.Duration(deviceCodeResponse.ExpiresIn)),
+	})
+	if err != nil {
+		a.logger.Warningf("failed to save pending device flow in store: %v", err)
+	}
+}
+
+func (a *DefaultImpl) clearPendingFlow() {
+	pendingStore, ok := a.store.(pendingFlowStore)
+	if !ok {
+		return
+	}
+
+	if err := pendingStore.ClearPendingFlow(); err != nil {
+		a.logger.Warningf("failed to remove pending device flow from store: %v", err)
+	}
+}
+
+func (a *DefaultImpl) openBrowser(ctx context.Context, toOpen string) bool {
+	if err := a.openURL(ctx, toOpen); err != nil {
+		a.logger.Warningf("error opening browser window: %v", err)
+		a.emitProgress(ProgressEvent{
+			Type:  ProgressEventBrowserFailed,
+			Error: err.Error(),
+		})
+		return false
+	}
+
+	a.emitProgress(ProgressEvent{
+		Type: ProgressEventBrowserOpened,
+	})
+	return true
+}
+
+func (a *DefaultImpl) openURL(ctx context.Context, toOpen string) error {
+	opener := a.browserOpener
+	if opener == nil {
+		if a.headlessDetection && getenv("BROWSER") == "" {
+			if headless, reason := detectHeadless(); headless {
+				return errors.Errorf("not opening a browser window: %s", reason)
+			}
 		}
+		opener = DefaultBrowserOpener
 	}
 
-	return authentication, nil
+	return opener(ctx, toOpen)
 }
 
 func (a *DefaultImpl) Refresh(ctx context.Context, refreshToken string) (Authentication, error) {
@@ -132,29 +373,36 @@ func (a *DefaultImpl) Refresh(ctx context.Context, refreshToken string) (Authent
 		newRefreshToken = refreshTokenResponse.RefreshToken
 	}
 
-	authentication, err := a.buildAuthentication(ctx, refreshTokenResponse.AccessToken, refreshTokenResponse.IdToken, newRefreshToken)
+	authentication, err := a.buildAuthentication(ctx, refreshTokenResponse.AccessToken, refreshTokenResponse.IdToken, newRefreshToken, refreshTokenResponse.ExpiresIn)
 	if err != nil {
 		return Authentication{}, errors.Wrap(err, "error building authentication")
 	}
 
-	err = a.store.Save(authentication)
-	if err != nil {
-		a.logger.Errorf("error saving the refreshed authentication: %v", err)
+	if a.store != nil {
+		err = a.store.Save(authentication)
+		if err != nil {
+			a.logger.Errorf("error saving the refreshed authentication: %v", err)
+		} else {
+			a.opportunisticHousekeeping()
+		}
 	}
 
 	return authentication, nil
 }
 
-func (a *DefaultImpl) buildAuthentication(ctx context.Context, accessToken, idToken, refreshToken string) (Authentication, error) {
+// buildAuthentication accepts opaque or encrypted access tokens too: the expiration then comes
+// from expiresIn, the permissions from the identity token or the user profile.
+func (a *DefaultImpl) buildAuthentication(ctx context.Context, accessToken, idToken, refreshToken string, expiresIn int) (Authentication, error) {
+	receivedAt := time.Now()
 
-	var accessTokenContent accessTokenContentDTO
-	_, _, err := jwt.NewParser().ParseUnverified(accessToken, &accessTokenContent)
+	accessTokenContent, err := a.parseAccessToken(accessToken)
 	if err != nil {
-		return Authentication{}, errors.Wrap(err, "error decoding access token")
+		a.logger.Debugf("access token is not a readable JWT, relying on expires_in: %v", err)
+		accessTokenContent = &accessTokenContentDTO{}
 	}
 
+	var idTokenContent idTokenContentDTO
 	if idToken != "" {
-		var idTokenContent idTokenContentDTO
 		_, _, err = jwt.NewParser().ParseUnverified(idToken, &idTokenContent)
 		if err != nil {
 			return Authentication{}, errors.Wrap(err, "error decoding identity token")
@@ -169,6 +417,16 @@ func (a *DefaultImpl) buildAuthentication(ctx context.Context, accessToken, idTo
 	expiresAt := time.Time{}
 	if accessTokenContent.ExpiresAt != nil {
 		expiresAt = (*accessTokenContent.ExpiresAt).Time
+	} else if expiresIn > 0 {
+		expiresAt = receivedAt.Add(time.Duration(expiresIn) * time.Second)
+	}
+
+	permissions := accessTokenContent.Permissions
+	if permissions == nil {
+		permissions = idTokenContent.Permissions
+	}
+	if permissions == nil {
+		permissions = userInfoResponse.Permissions
 	}
 
 	return Authentication{
@@ -193,7 +451,7 @@ func (a *DefaultImpl) buildAuthentication(ctx context.Context, accessToken, idTo
 			PhoneNumberVerified: userInfoResponse.PhoneNumberVerified,
 			Address:             userInfoResponse.Address,
 			UpdatedAt:           userInfoResponse.UpdatedAt,
-			Permissions:         accessTokenContent.Permissions,
+			Permissions:         permissions,
 		},
 		Tokens: Tokens{
 			AccessToken:  accessToken,
@@ -204,9 +462,15 @@ func (a *DefaultImpl) buildAuthentication(ctx context.Context, accessToken, idTo
 	}, nil
 }
 
+// polling timings, variables so that tests can shorten them
+var (
+	minPollingInterval = time.Second
+	slowDownIncrement  = time.Second
+)
+
 func (a *DefaultImpl) pollForToken(ctx context.Context, deviceCode string, pollingInterval time.Duration) (tokenResponseDTO, error) {
-	if pollingInterval < time.Second {
-		pollingInterval = time.Second
+	if pollingInterval < minPollingInterval {
+		pollingInterval = minPollingInterval
 	}
 
 	a.logger.Debugf("will poll for an authorization token every %d ms", pollingInterval.Milliseconds())
@@ -214,6 +478,9 @@ func (a *DefaultImpl) pollForToken(ctx context.Context, deviceCode string, polli
 	var token tokenResponseDTO
 	var err error
 
+	attempt := 0
+	transientErrors := 0
+
 	for {
 		select {
 		case <-time.After(pollingInterval):
@@ -222,21 +489,53 @@ func (a *DefaultImpl) pollForToken(ctx context.Context, deviceCode string, polli
 			return tokenResponseDTO{}, ctx.Err()
 		}
 
+		attempt++
 		token, err = a.getTokenFromDeviceCode(ctx, deviceCode)
 		if err == nil {
 			break
 		}
 
-		switch err {
-		case errAuthorizationPending:
+		progress := PollingProgress{
+			Attempt: attempt,
+			Err:     err,
+		}
+
+		switch {
+		case err == errAuthorizationPending:
 			a.logger.Debugf("still waiting ... (%v)", err)
-		case errSlowDown:
+			transientErrors = 0
+			progress.Status = PollingStatusPending
+			a.emitProgress(ProgressEvent{
+				Type:     ProgressEventPollPending,
+				Interval: int(pollingInterval.Seconds()),
+			})
+		case err == errSlowDown:
 			a.logger.Debugf("have to slow down (%v)", err)
-			pollingInterval += time.Second
+			transientErrors = 0
+			pollingInterval += slowDownIncrement
 			a.logger.Debugf("polling every %d ms", pollingInterval.Milliseconds())
+			progress.Status = PollingStatusSlowDown
+			a.emitProgress(ProgressEvent{
+				Type:     ProgressEventSlowDown,
+				Interval: int(pollingInterval.Seconds()),
+			})
+		case ctx.Err() == nil && isTransientError(err) && transientErrors < maxConsecutiveTransientPollingErrors:
+			transientErrors++
+			a.logger.Warningf("transient error polling for verification status, will retry (%v)", err)
+			progress.Status = PollingStatusTransientError
 		default:
 			return tokenResponseDTO{}, errors.Wrap(err, "error polling for verification status")
 		}
+
+		progress.Interval = pollingInterval
+		progress.NextPollAt = time.Now().Add(pollingInterval)
+
+		if a.pollingProgressCallback != nil {
+			if abortErr := a.pollingProgressCallback(progress); abortErr != nil {
+				a.logger.Debugf("polling aborted by the progress callback (%v)", abortErr)
+				return tokenResponseDTO{}, errors.Wrap(abortErr, "polling aborted")
+			}
+		}
 	}
 
 	return token, nil
@@ -247,13 +546,10 @@ func (a *DefaultImpl) loadFromStore(ctx context.Context) (*Authentication, error
 		return nil, errors.New("missing store implementation")
 	}
 
-	loaded, err := a.store.Load()
-	if err != nil {
+	loaded, err := a.loadValidatedFromStore()
+	if err != nil || loaded == nil {
 		return nil, err
 	}
-	if loaded == nil {
-		return nil, nil
-	}
 
 	if loaded.Tokens.ExpiresAt.IsZero() {
 		return nil, errors.New("restored tokens have an unknown expiration date")
@@ -282,3 +578,86 @@ func (a *DefaultImpl) loadFromStore(ctx context.Context) (*Authentication, error
 
 	return &refreshed, nil
 }
+
+// loadValidatedFromStore loads the cached authentication, without refreshing it.
+// An authentication of another tenant is removed from the store, so that it is not found again.
+func (a *DefaultImpl) loadValidatedFromStore() (*Authentication, error) {
+	loaded, err := a.store.Load()
+	if err != nil || loaded == nil {
+		return nil, err
+	}
+
+	if err = a.validateRestoredTokens(loaded.Tokens); err != nil {
+		if clearErr := a.store.Clear(); clearErr != nil {
+			a.logger.Warningf("error removing the rejected authentication from store: %v", clearErr)
+		}
+		return nil, errors.Wrap(err, "restored tokens are not valid for this tenant")
+	}
+
+	return loaded, nil
+}
+
+// validateRestoredTokens checks that the cached access token was issued by the configured domain,
+// for the configured audience and client: the cache file may have been edited by hand,
+// or belong to another tenant.
+func (a *DefaultImpl) validateRestoredTokens(tokens Tokens) error {
+	claims, err := a.parseAccessToken(tokens.AccessToken)
+	if err != nil {
+		// opaque access tokens can't tell: the identity token issued with them can
+		if tokens.IdToken == "" {
+			return errors.Wrap(err, "error decoding access token")
+		}
+		return a.validateRestoredIdToken(tokens.IdToken)
+	}
+
+	if !sameIssuer(claims.Issuer, a.domain.String()) {
+		return errors.Errorf("access token issued by %q", claims.Issuer)
+	}
+	if a.audience != "" && !claims.VerifyAudience(a.audience, true) {
+		return errors.Errorf("access token issued for audience %q", strings.Join(claims.Audience, " "))
+	}
+	if claims.Azp != "" && claims.Azp != a.clientID {
+		return errors.Errorf("access token issued to client %q", claims.Azp)
+	}
+
+	return nil
+}
+
+func (a *DefaultImpl) validateRestoredIdToken(idToken string) error {
+	var claims idTokenContentDTO
+	if _, _, err := jwt.NewParser().ParseUnverified(idToken, &claims); err != nil {
+		return errors.Wrap(err, "error decoding identity token")
+	}
+
+	if !sameIssuer(claims.Issuer, a.domain.String()) {
+		return errors.Errorf("identity token issued by %q", claims.Issuer)
+	}
+	if !claims.VerifyAudience(a.clientID, true) {
+		return errors.Errorf("identity token issued to client %q", strings.Join(claims.Audience, " "))
+	}
+
+	return nil
+}
+
+// parseAccessToken decodes the claims of the access token, without verifying its signature.
+// JWE tokens are decrypted first, when a decryption key is configured.
+func (a *DefaultImpl) parseAccessToken(accessToken string) (*accessTokenContentDTO, error) {
+	var claims accessTokenContentDTO
+
+	if a.accessTokenDecryptionKey != nil && isJWE(accessToken) {
+		if err := parseJWEClaims(accessToken, a.accessTokenDecryptionKey, &claims); err != nil {
+			return nil, errors.Wrap(err, "error decrypting access token")
+		}
+		return &claims, nil
+	}
+
+	if _, _, err := jwt.NewParser().ParseUnverified(accessToken, &claims); err != nil {
+		return nil, err
+	}
+	return &claims, nil
+}
+
+// sameIssuer compares issuers ignoring the trailing slash, which Auth0 adds to the domain.
+func sameIssuer(issuer, domain string) bool {
+	return issuer != "" && strings.TrimSuffix(issuer, "/") == strings.TrimSuffix(domain, "/")
+}
@@ -0,0 +1,512 @@
+package auth0cliauthorizer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// fakeAuth0 serves the endpoints used by the device flow.
+type fakeAuth0 struct {
+	srv *httptest.Server
+
+	mu sync.Mutex
+	// pending is the number of token polls answered with authorization_pending
+	pending int
+	// accessToken replaces the JWT access token when set
+	accessToken string
+	expiresIn   int
+	sub         string
+	// failUserInfo makes the userinfo endpoint fail
+	failUserInfo bool
+	// script answers the token polls in order, before the pending ones
+	script []fakeResponse
+
+	deviceCodeRequests []url.Values
+	tokenPolls         int
+	revocations        []url.Values
+	// failRevoke makes the revoke endpoint fail
+	failRevoke bool
+}
+
+func newFakeAuth0(t *testing.T) *fakeAuth0 {
+	f := &fakeAuth0{expiresIn: 3600, sub: "auth0|alice"}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/oauth/device/code", func(w http.ResponseWriter, r *http.Request) {
+		_ = r.ParseForm()
+		f.mu.Lock()
+		f.deviceCodeRequests = append(f.deviceCodeRequests, r.PostForm)
+		f.mu.Unlock()
+
+		writeTestJSON(w, http.StatusOK, map[string]interface{}{
+			"device_code":               "device-code",
+			"user_code":                 "ABCD-EFGH",
+			"verification_uri":          f.srv.URL + "/activate",
+			"verification_uri_complete": f.srv.URL + "/activate?user_code=ABCD-EFGH",
+			"expires_in":                900,
+			"interval":                  0,
+		})
+	})
+	mux.HandleFunc("/oauth/token", func(w http.ResponseWriter, r *http.Request) {
+		_ = r.ParseForm()
+		f.mu.Lock()
+		defer f.mu.Unlock()
+
+		if r.PostForm.Get("grant_type") != "refresh_token" {
+			if len(f.script) > 0 {
+				response := f.script[0]
+				f.script = f.script[1:]
+				response.write(w)
+				return
+			}
+			f.tokenPolls++
+			if f.tokenPolls <= f.pending {
+				writeTestJSON(w, http.StatusForbidden, map[string]string{
+					"error":             "authorization_pending",
+					"error_description": "User has yet to authorize device code.",
+				})
+				return
+			}
+		}
+
+		accessToken := f.accessToken
+		if accessToken == "" {
+			accessToken = f.signedAccessToken(f.srv.URL+"/", "https://api")
+		}
+		writeTestJSON(w, http.StatusOK, map[string]interface{}{
+			"access_token":  accessToken,
+			"id_token":      f.signedIdToken(f.srv.URL + "/"),
+			"refresh_token": "refresh-token",
+			"token_type":    "Bearer",
+			"expires_in":    f.expiresIn,
+		})
+	})
+	mux.HandleFunc("/userinfo", func(w http.ResponseWriter, r *http.Request) {
+		if f.failUserInfo {
+			writeTestJSON(w, http.StatusInternalServerError, map[string]string{"error": "server_error"})
+			return
+		}
+		writeTestJSON(w, http.StatusOK, map[string]interface{}{"email": "alice@example.com", "sub": f.sub})
+	})
+	mux.HandleFunc("/oauth/revoke", func(w http.ResponseWriter, r *http.Request) {
+		_ = r.ParseForm()
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		if f.failRevoke {
+			writeTestJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_request"})
+			return
+		}
+		f.revocations = append(f.revocations, r.PostForm)
+		w.WriteHeader(http.StatusOK)
+	})
+
+	f.srv = httptest.NewServer(mux)
+	t.Cleanup(f.srv.Close)
+	return f
+}
+
+func (f *fakeAuth0) signedAccessToken(issuer, audience string) string {
+	claims := jwt.MapClaims{
+		"iss":         issuer,
+		"aud":         []string{audience, f.srv.URL + "/userinfo"},
+		"azp":         "client",
+		"sub":         f.sub,
+		"exp":         time.Now().Add(time.Hour).Unix(),
+		"permissions": []string{"read:things"},
+	}
+	signed, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte("secret"))
+	return signed
+}
+
+func (f *fakeAuth0) signedIdToken(issuer string) string {
+	claims := jwt.MapClaims{
+		"iss":   issuer,
+		"aud":   "client",
+		"sub":   f.sub,
+		"email": "alice@example.com",
+		"exp":   time.Now().Add(time.Hour).Unix(),
+	}
+	signed, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte("secret"))
+	return signed
+}
+
+func (f *fakeAuth0) deviceCodeRequestCount() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.deviceCodeRequests)
+}
+
+func (f *fakeAuth0) revokedTokens() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var tokens []string
+	for _, revocation := range f.revocations {
+		tokens = append(tokens, revocation.Get("token"))
+	}
+	return tokens
+}
+
+// fakeResponse is an error answered by the fake server: a JSON one when error is set.
+type fakeResponse struct {
+	status int
+	error  string
+}
+
+func (r fakeResponse) write(w http.ResponseWriter) {
+	if r.error == "" {
+		http.Error(w, http.StatusText(r.status), r.status)
+		return
+	}
+	writeTestJSON(w, r.status, map[string]string{"error": r.error, "error_description": r.error})
+}
+
+func writeTestJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("content-type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func newTestAuthorizer(t *testing.T, f *fakeAuth0, audience string, options ...Option) *DefaultImpl {
+	options = append([]Option{
+		WithLogger(nil),
+		WithAutoOpenBrowser(false),
+		WithDeviceConfirmPromptCallback(func(DeviceConfirmPrompt) error { return nil }),
+	}, options...)
+
+	a, err := New(f.srv.URL, "client", audience, options...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return a
+}
+
+func assertExpiresIn(t *testing.T, authentication Authentication, expiresIn time.Duration) {
+	t.Helper()
+	expected := time.Now().Add(expiresIn)
+	if delta := authentication.Tokens.ExpiresAt.Sub(expected); delta > 5*time.Second || delta < -5*time.Second {
+		t.Fatalf("expected the token to expire at about %s, got %s", expected, authentication.Tokens.ExpiresAt)
+	}
+}
+
+func TestAuthorizeWithoutAudience(t *testing.T) {
+	f := newFakeAuth0(t)
+	a := newTestAuthorizer(t, f, "")
+
+	if _, err := a.Authorize(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if _, sent := f.deviceCodeRequests[0]["audience"]; sent {
+		t.Fatalf("expected no audience in the device code request, got %v", f.deviceCodeRequests[0])
+	}
+}
+
+func TestAuthorizeOpaqueAccessTokenExpiresIn(t *testing.T) {
+	f := newFakeAuth0(t)
+	f.accessToken = "opaque-access-token"
+	f.expiresIn = 600
+	a := newTestAuthorizer(t, f, "")
+
+	authentication, err := a.Authorize(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertExpiresIn(t, authentication, 600*time.Second)
+	if authentication.User.Email != "alice@example.com" {
+		t.Fatalf("expected the user profile from userinfo, got %+v", authentication.User)
+	}
+}
+
+func TestAuthorizeEncryptedAccessTokenExpiresIn(t *testing.T) {
+	f := newFakeAuth0(t)
+	key := generateTestRSAKey(t)
+	f.accessToken = encryptTestJWE(t, &key.PublicKey, jweHeader{Algorithm: jweAlgorithm, Encryption: jweEncryption}, 32,
+		[]byte(`{"exp":1}`))
+	f.expiresIn = 600
+	a := newTestAuthorizer(t, f, "https://api")
+
+	authentication, err := a.Authorize(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertExpiresIn(t, authentication, 600*time.Second)
+	if authentication.Tokens.AccessToken != f.accessToken {
+		t.Fatal("expected the encrypted access token to be kept as it is")
+	}
+}
+
+func TestAuthorizePromptOutcomeAfterAuthentication(t *testing.T) {
+	f := newFakeAuth0(t)
+	f.failUserInfo = true
+
+	var prompt DeviceConfirmPrompt
+	a := newTestAuthorizer(t, f, "https://api", WithDeviceConfirmPromptCallback(func(p DeviceConfirmPrompt) error {
+		prompt = p
+		return nil
+	}))
+
+	if _, err := a.Authorize(context.Background()); err == nil {
+		t.Fatal("expected the authorization to fail")
+	}
+	select {
+	case <-prompt.Done():
+	default:
+		t.Fatal("expected the prompt outcome to be completed")
+	}
+	if prompt.Err() == nil {
+		t.Fatal("expected the prompt outcome to report the failure building the authentication")
+	}
+}
+
+func TestAuthorizeResumesPendingDeviceFlow(t *testing.T) {
+	f := newFakeAuth0(t)
+	f.pending = 1000
+	a := newTestAuthorizer(t, f, "https://api", WithFileSystemStore(t.TempDir(), 0))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 1500*time.Millisecond)
+	defer cancel()
+	if _, err := a.Authorize(ctx); err == nil {
+		t.Fatal("expected the authorization to be interrupted")
+	}
+
+	f.mu.Lock()
+	f.pending = 0
+	f.mu.Unlock()
+
+	authentication, err := a.Authorize(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if authentication.User.Sub != f.sub {
+		t.Fatalf("unexpected user %+v", authentication.User)
+	}
+	if n := f.deviceCodeRequestCount(); n != 1 {
+		t.Fatalf("expected the pending device flow to be resumed, got %d device code requests", n)
+	}
+
+	// the completed flow is not resumed again
+	if err = a.Logout(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = a.Authorize(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if n := f.deviceCodeRequestCount(); n != 2 {
+		t.Fatalf("expected a new device flow after the completed one, got %d device code requests", n)
+	}
+}
+
+func TestAuthorizeRejectsRestoredTokensOfAnotherTenant(t *testing.T) {
+	f := newFakeAuth0(t)
+	a := newTestAuthorizer(t, f, "https://api", WithFileSystemStore(t.TempDir(), 0))
+
+	foreign := Authentication{
+		User: User{Sub: f.sub, Email: "alice@example.com"},
+		Tokens: Tokens{
+			AccessToken:  f.signedAccessToken("https://other.eu.auth0.com/", "https://api"),
+			RefreshToken: "foreign-refresh-token",
+			ExpiresAt:    time.Now().Add(time.Hour),
+		},
+	}
+	if err := a.store.Save(foreign); err != nil {
+		t.Fatal(err)
+	}
+
+	authentication, err := a.Authorize(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if authentication.Tokens.AccessToken == foreign.Tokens.AccessToken {
+		t.Fatal("expected the tokens of another tenant to be ignored")
+	}
+	if n := f.deviceCodeRequestCount(); n != 1 {
+		t.Fatalf("expected a new device flow, got %d device code requests", n)
+	}
+}
+
+func TestLoadFromStoreClearsRestoredTokensOfAnotherTenant(t *testing.T) {
+	f := newFakeAuth0(t)
+	a := newTestAuthorizer(t, f, "https://api", WithFileSystemStore(t.TempDir(), 0))
+
+	err := a.store.Save(Authentication{
+		User: User{Sub: f.sub, Email: "alice@example.com"},
+		Tokens: Tokens{
+			AccessToken:  f.signedAccessToken("https://other.eu.auth0.com/", "https://api"),
+			RefreshToken: "foreign-refresh-token",
+			ExpiresAt:    time.Now().Add(time.Hour),
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if loaded, err := a.loadFromStore(context.Background()); err == nil || loaded != nil {
+		t.Fatalf("expected the tokens of another tenant to be rejected, got %v, %v", loaded, err)
+	}
+	if loaded, err := a.store.Load(); err != nil || loaded != nil {
+		t.Fatalf("expected the rejected tokens to be removed from the store, got %v, %v", loaded, err)
+	}
+}
+
+func TestValidateRestoredTokens(t *testing.T) {
+	f := newFakeAuth0(t)
+	a := newTestAuthorizer(t, f, "https://api")
+	issuer := f.srv.URL + "/"
+
+	for name, tc := range map[string]struct {
+		tokens Tokens
+		valid  bool
+	}{
+		"valid":          {Tokens{AccessToken: f.signedAccessToken(issuer, "https://api")}, true},
+		"issuer":         {Tokens{AccessToken: f.signedAccessToken("https://other.eu.auth0.com/", "https://api")}, false},
+		"audience":       {Tokens{AccessToken: f.signedAccessToken(issuer, "https://other-api")}, false},
+		"opaque":         {Tokens{AccessToken: "opaque", IdToken: f.signedIdToken(issuer)}, true},
+		"opaque foreign": {Tokens{AccessToken: "opaque", IdToken: f.signedIdToken("https://other.eu.auth0.com/")}, false},
+		"opaque alone":   {Tokens{AccessToken: "opaque"}, false},
+	} {
+		t.Run(name, func(t *testing.T) {
+			err := a.validateRestoredTokens(tc.tokens)
+			if tc.valid && err != nil {
+				t.Fatalf("expected the tokens to be valid, got %v", err)
+			}
+			if !tc.valid && err == nil {
+				t.Fatal("expected the tokens to be refused")
+			}
+		})
+	}
+}
+
+func TestPollForToken(t *testing.T) {
+	defer func(interval, increment time.Duration) {
+		minPollingInterval, slowDownIncrement = interval, increment
+	}(minPollingInterval, slowDownIncrement)
+	minPollingInterval, slowDownIncrement = time.Millisecond, 10*time.Millisecond
+
+	pending := fakeResponse{http.StatusForbidden, "authorization_pending"}
+	slowDown := fakeResponse{http.StatusTooManyRequests, "slow_down"}
+	unavailable := fakeResponse{http.StatusServiceUnavailable, ""}
+	errAbort := errors.New("aborted by the user")
+
+	for name, tc := range map[string]struct {
+		script []fakeResponse
+		// abortAt makes the progress callback fail at the given attempt
+		abortAt   int
+		expected  []PollingStatus
+		intervals []time.Duration
+		err       error
+	}{
+		"pending then success": {
+			script:   []fakeResponse{pending, pending},
+			expected: []PollingStatus{PollingStatusPending, PollingStatusPending},
+		},
+		"slow down increases the interval": {
+			script:    []fakeResponse{slowDown, pending, slowDown},
+			expected:  []PollingStatus{PollingStatusSlowDown, PollingStatusPending, PollingStatusSlowDown},
+			intervals: []time.Duration{11 * time.Millisecond, 11 * time.Millisecond, 21 * time.Millisecond},
+		},
+		"retries transient errors": {
+			script:   []fakeResponse{unavailable, unavailable, unavailable, unavailable, unavailable},
+			expected: []PollingStatus{PollingStatusTransientError, PollingStatusTransientError, PollingStatusTransientError, PollingStatusTransientError, PollingStatusTransientError},
+		},
+		"pending resets the transient errors": {
+			script: []fakeResponse{unavailable, unavailable, unavailable, unavailable, unavailable, pending,
+				unavailable, unavailable, unavailable, unavailable, unavailable},
+			expected: []PollingStatus{PollingStatusTransientError, PollingStatusTransientError, PollingStatusTransientError, PollingStatusTransientError, PollingStatusTransientError,
+				PollingStatusPending, PollingStatusTransientError, PollingStatusTransientError, PollingStatusTransientError, PollingStatusTransientError, PollingStatusTransientError},
+		},
+		"gives up after 5 transient errors": {
+			script:   []fakeResponse{unavailable, unavailable, unavailable, unavailable, unavailable, unavailable},
+			expected: []PollingStatus{PollingStatusTransientError, PollingStatusTransientError, PollingStatusTransientError, PollingStatusTransientError, PollingStatusTransientError},
+			err:      &httpStatusError{},
+		},
+		"access denied": {
+			script:   []fakeResponse{pending, {http.StatusForbidden, "access_denied"}},
+			expected: []PollingStatus{PollingStatusPending},
+			err:      errAccessDenied,
+		},
+		"expired token": {
+			script: []fakeResponse{{http.StatusForbidden, "expired_token"}},
+			err:    errExpiredToken,
+		},
+		"aborted by the callback": {
+			script:   []fakeResponse{pending, pending, pending},
+			abortAt:  2,
+			expected: []PollingStatus{PollingStatusPending, PollingStatusPending},
+			err:      errAbort,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			f := newFakeAuth0(t)
+			f.script = tc.script
+
+			var statuses []PollingStatus
+			var intervals []time.Duration
+			a := newTestAuthorizer(t, f, "https://api", WithPollingProgressCallback(func(progress PollingProgress) error {
+				statuses = append(statuses, progress.Status)
+				intervals = append(intervals, progress.Interval)
+				if progress.Attempt == tc.abortAt {
+					return errAbort
+				}
+				return nil
+			}))
+
+			token, err := a.pollForToken(context.Background(), "device-code", time.Millisecond)
+			switch expected := tc.err.(type) {
+			case nil:
+				if err != nil || token.AccessToken == "" {
+					t.Fatalf("expected a token, got %v", err)
+				}
+			case *httpStatusError:
+				if !errors.As(err, &expected) || expected.StatusCode != http.StatusServiceUnavailable {
+					t.Fatalf("expected the last transient error, got %v", err)
+				}
+			default:
+				if !errors.Is(err, tc.err) {
+					t.Fatalf("expected %v, got %v", tc.err, err)
+				}
+			}
+
+			if !reflect.DeepEqual(statuses, tc.expected) {
+				t.Fatalf("expected the statuses %v, got %v", tc.expected, statuses)
+			}
+			if tc.intervals != nil && !reflect.DeepEqual(intervals, tc.intervals) {
+				t.Fatalf("expected the intervals %v, got %v", tc.intervals, intervals)
+			}
+		})
+	}
+}
+
+func TestAuthorizeWithCustomStore(t *testing.T) {
+	f := newFakeAuth0(t)
+	var keys []string
+	memory := newMemoryStoreFactory()
+	factory := func(key string) (Store, error) {
+		keys = append(keys, key)
+		return memory(key)
+	}
+
+	for i := 0; i < 2; i++ {
+		a := newTestAuthorizer(t, f, "https://api", WithStore(factory, time.Minute))
+		if _, err := a.Authorize(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the second authorizer finds the session saved by the first one
+	if count := f.deviceCodeRequestCount(); count != 1 {
+		t.Fatalf("expected a single device flow, got %d", count)
+	}
+	expectedKey := storeKey(f.srv.URL, "client", "https://api", nil)
+	if len(keys) != 2 || keys[0] != expectedKey || keys[1] != expectedKey {
+		t.Fatalf("expected the factory to be invoked with %s, got %v", expectedKey, keys)
+	}
+}
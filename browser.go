@@ -0,0 +1,137 @@
+package auth0cliauthorizer
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+
+	"github.com/pkg/browser"
+	"github.com/pkg/errors"
+)
+
+type BrowserOpener func(ctx context.Context, url string) error
+
+var _ BrowserOpener = DefaultBrowserOpener
+
+// how the openers find and start commands, variables so that tests can record them
+var (
+	lookPath     = exec.LookPath
+	startCommand = startProcess
+)
+
+// DefaultBrowserOpener honors the BROWSER environment variable, uses wslview
+// when running under WSL and otherwise opens the system default browser.
+func DefaultBrowserOpener(ctx context.Context, url string) error {
+	if value := getenv("BROWSER"); value != "" {
+		return openWithBrowserEnv(ctx, value, url)
+	}
+
+	if isWSL() {
+		if _, err := lookPath("wslview"); err == nil {
+			return startCommand(ctx, []string{"wslview", url})
+		}
+	}
+
+	return browser.OpenURL(url)
+}
+
+// NewChromeProfileOpener opens URLs in Google Chrome (or Chromium) using the
+// given profile directory, as in "Default" or "Profile 1".
+func NewChromeProfileOpener(profileDirectory string) BrowserOpener {
+	profileArg := "--profile-directory=" + profileDirectory
+
+	return func(ctx context.Context, url string) error {
+		switch runtime.GOOS {
+		case "darwin":
+			return startCommand(ctx, []string{"open", "-na", "Google Chrome", "--args", profileArg, url})
+		case "windows":
+			return startCommand(ctx, []string{"cmd", "/c", "start", "", "chrome", profileArg, escapeForCmd(url)})
+		default:
+			return startFirstAvailable(ctx, []string{"google-chrome", "google-chrome-stable", "chromium", "chromium-browser"},
+				profileArg, url)
+		}
+	}
+}
+
+// NewFirefoxProfileOpener opens URLs in a new tab of Firefox using the given profile name.
+func NewFirefoxProfileOpener(profile string) BrowserOpener {
+	return func(ctx context.Context, url string) error {
+		switch runtime.GOOS {
+		case "darwin":
+			return startCommand(ctx, []string{"open", "-na", "Firefox", "--args", "-P", profile, "-new-tab", url})
+		case "windows":
+			return startCommand(ctx, []string{"cmd", "/c", "start", "", "firefox", "-P", profile, "-new-tab", escapeForCmd(url)})
+		default:
+			return startFirstAvailable(ctx, []string{"firefox", "firefox-esr"}, "-P", profile, "-new-tab", url)
+		}
+	}
+}
+
+// openWithBrowserEnv follows the BROWSER convention: a list of commands separated
+// by the path list separator, where %s is replaced with the URL (appended if missing).
+func openWithBrowserEnv(ctx context.Context, value, url string) error {
+	var lastErr error
+	for _, command := range strings.Split(value, string(os.PathListSeparator)) {
+		args := strings.Fields(command)
+		if len(args) == 0 {
+			continue
+		}
+
+		replaced := false
+		for i, arg := range args {
+			if strings.Contains(arg, "%s") {
+				args[i] = strings.ReplaceAll(arg, "%s", url)
+				replaced = true
+			}
+		}
+		if !replaced {
+			args = append(args, url)
+		}
+
+		if lastErr = startCommand(ctx, args); lastErr == nil {
+			return nil
+		}
+	}
+
+	if lastErr == nil {
+		return errors.New("no usable command in the BROWSER environment variable")
+	}
+	return lastErr
+}
+
+func startFirstAvailable(ctx context.Context, candidates []string, args ...string) error {
+	for _, candidate := range candidates {
+		if _, err := lookPath(candidate); err == nil {
+			return startCommand(ctx, append([]string{candidate}, args...))
+		}
+	}
+	return errors.Errorf("none of %s could be found", strings.Join(candidates, ", "))
+}
+
+func startProcess(ctx context.Context, args []string) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	// not bound to the context: the browser must survive the end of the authorization flow
+	cmd := exec.Command(args[0], args[1:]...)
+	if err := cmd.Start(); err != nil {
+		return errors.Wrapf(err, "error running %s", args[0])
+	}
+
+	// browsers may keep running long after the URL has been opened
+	go func() {
+		_ = cmd.Wait()
+	}()
+
+	return nil
+}
+
+// cmdEscaper escapes the characters cmd.exe would interpret in the URL passed to start.
+var cmdEscaper = strings.NewReplacer("^", "^^", "&", "^&", "|", "^|", "<", "^<", ">", "^>", "%", "^%")
+
+func escapeForCmd(url string) string {
+	return cmdEscaper.Replace(url)
+}
@@ -0,0 +1,165 @@
+package auth0cliauthorizer
+
+import (
+	"context"
+	"errors"
+	"os"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// recordCommands replaces the command launcher: commands named in failing fail to start.
+func recordCommands(t *testing.T, failing ...string) *[][]string {
+	previous := startCommand
+	t.Cleanup(func() { startCommand = previous })
+
+	var started [][]string
+	startCommand = func(_ context.Context, args []string) error {
+		started = append(started, args)
+		for _, name := range failing {
+			if args[0] == name {
+				return errors.New(name + " not found")
+			}
+		}
+		return nil
+	}
+	return &started
+}
+
+func TestEscapeForCmd(t *testing.T) {
+	for url, expected := range map[string]string{
+		"https://tenant.eu.auth0.com/activate":                 "https://tenant.eu.auth0.com/activate",
+		"https://tenant.eu.auth0.com/activate?user_code=A&x=1": "https://tenant.eu.auth0.com/activate?user_code=A^&x=1",
+		"https://tenant.eu.auth0.com/v2/logout?returnTo=a%3Ab": "https://tenant.eu.auth0.com/v2/logout?returnTo=a^%3Ab",
+		"https://example.com/^|<>":                             "https://example.com/^^^|^<^>",
+	} {
+		if escaped := escapeForCmd(url); escaped != expected {
+			t.Errorf("expected %s to be escaped as %s, got %s", url, expected, escaped)
+		}
+	}
+}
+
+func TestOpenWithBrowserEnv(t *testing.T) {
+	const url = "https://tenant.eu.auth0.com/activate?user_code=ABCD-EFGH"
+	separator := string(os.PathListSeparator)
+
+	for name, tc := range map[string]struct {
+		value    string
+		failing  []string
+		expected [][]string
+		err      bool
+	}{
+		"appends the url": {
+			value:    "firefox",
+			expected: [][]string{{"firefox", url}},
+		},
+		"replaces %s": {
+			value:    "open -a Safari %s --new",
+			expected: [][]string{{"open", "-a", "Safari", url, "--new"}},
+		},
+		"replaces %s inside an argument": {
+			value:    "browser --url=%s",
+			expected: [][]string{{"browser", "--url=" + url}},
+		},
+		"falls back to the next command": {
+			value:    "missing %s" + separator + separator + "firefox",
+			failing:  []string{"missing"},
+			expected: [][]string{{"missing", url}, {"firefox", url}},
+		},
+		"stops at the first command that starts": {
+			value:    "firefox" + separator + "chromium",
+			expected: [][]string{{"firefox", url}},
+		},
+		"fails when no command starts": {
+			value:    "missing" + separator + "broken",
+			failing:  []string{"missing", "broken"},
+			expected: [][]string{{"missing", url}, {"broken", url}},
+			err:      true,
+		},
+		"fails without commands": {
+			value: " " + separator,
+			err:   true,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			started := recordCommands(t, tc.failing...)
+
+			err := openWithBrowserEnv(context.Background(), tc.value, url)
+			if (err != nil) != tc.err {
+				t.Fatalf("expected an error: %v, got %v", tc.err, err)
+			}
+			if !reflect.DeepEqual(*started, tc.expected) {
+				t.Fatalf("expected %v to be started, got %v", tc.expected, *started)
+			}
+		})
+	}
+}
+
+func TestDefaultBrowserOpener(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("WSL is only detected on linux")
+	}
+	const url = "https://tenant.eu.auth0.com/activate"
+
+	previousLookPath := lookPath
+	t.Cleanup(func() { lookPath = previousLookPath })
+	lookPath = func(file string) (string, error) {
+		if file == "wslview" {
+			return "/usr/bin/wslview", nil
+		}
+		return "", errors.New(file + " not found")
+	}
+
+	for name, tc := range map[string]struct {
+		env      map[string]string
+		expected [][]string
+	}{
+		"wslview under WSL": {
+			env:      map[string]string{"WSL_DISTRO_NAME": "Ubuntu"},
+			expected: [][]string{{"wslview", url}},
+		},
+		"BROWSER wins over wslview": {
+			env:      map[string]string{"WSL_DISTRO_NAME": "Ubuntu", "BROWSER": "firefox"},
+			expected: [][]string{{"firefox", url}},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			fakeSession(t, tc.env, true, "")
+			started := recordCommands(t)
+
+			if err := DefaultBrowserOpener(context.Background(), url); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(*started, tc.expected) {
+				t.Fatalf("expected %v to be started, got %v", tc.expected, *started)
+			}
+		})
+	}
+}
+
+func TestNewChromeProfileOpenerFallsBackToChromium(t *testing.T) {
+	if runtime.GOOS == "darwin" || runtime.GOOS == "windows" {
+		t.Skip("chrome is looked up in the PATH on the other systems only")
+	}
+	const url = "https://tenant.eu.auth0.com/activate"
+
+	previousLookPath := lookPath
+	t.Cleanup(func() { lookPath = previousLookPath })
+	lookPath = func(file string) (string, error) {
+		if strings.HasPrefix(file, "chromium") {
+			return "/usr/bin/" + file, nil
+		}
+		return "", errors.New(file + " not found")
+	}
+	started := recordCommands(t)
+
+	if err := NewChromeProfileOpener("Profile 1")(context.Background(), url); err != nil {
+		t.Fatal(err)
+	}
+	expected := [][]string{{"chromium", "--profile-directory=Profile 1", url}}
+	if !reflect.DeepEqual(*started, expected) {
+		t.Fatalf("expected %v to be started, got %v", expected, *started)
+	}
+}
@@ -3,8 +3,12 @@ package auth0cliauthorizer
 import (
 	"crypto/md5"
 	"encoding/hex"
+	"io"
 	"net/http"
 	"net/url"
+	"os"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/pkg/errors"
@@ -21,9 +25,6 @@ func New(domain, clientID, audience string, options ...Option) (*DefaultImpl, er
 	if clientID == "" {
 		return nil, errors.New("missing clientID")
 	}
-	if audience == "" {
-		return nil, errors.New("missing audience")
-	}
 
 	domainURL, err := url.Parse(domain)
 	if err != nil {
@@ -31,7 +32,7 @@ func New(domain, clientID, audience string, options ...Option) (*DefaultImpl, er
 	}
 
 	if !domainURL.IsAbs() {
-		return nil, errors.Wrap(err, "domain is not an absolute URL")
+		return nil, errors.New("domain is not an absolute URL")
 	}
 
 	v := &DefaultImpl{
@@ -40,7 +41,9 @@ func New(domain, clientID, audience string, options ...Option) (*DefaultImpl, er
 		audience:             audience,
 		prefillDeviceCode:    true,
 		autoOpenBrowser:      true,
+		headlessDetection:    true,
 		requireOfflineAccess: true,
+		revokeOnLogout:       true,
 		logger: &loggerWrapper{
 			underlying: &consoleLogger{},
 		},
@@ -52,25 +55,60 @@ func New(domain, clientID, audience string, options ...Option) (*DefaultImpl, er
 		}
 	}
 
-	if !v.autoOpenBrowser && v.deviceConfirmPromptCallback == nil {
-		return nil, errors.New("autoOpenBrowser is disabled and no deviceConfirmPromptCallback was provided")
+	// the default logger must not corrupt a progress stream written to stdout
+	if console, ok := v.logger.underlying.(*consoleLogger); ok && v.progressWriter != nil && v.progressWriter.out == os.Stdout {
+		console.out = os.Stderr
+	}
+
+	if !v.autoOpenBrowser && v.deviceConfirmPromptCallback == nil && v.progressWriter == nil {
+		v.deviceConfirmPromptCallback = NewTerminalPrompt(nil)
 	}
 
 	if v.storeBuilder != nil {
-		h := md5.New()
-		h.Write([]byte(domain + "|" + clientID + "|" + audience))
-		hash := hex.EncodeToString(h.Sum(nil))
+		metadata := SessionMetadata{
+			Domain:   domain,
+			ClientID: clientID,
+			Audience: audience,
+			Scopes:   strings.Fields(v.effectiveScopes()),
+		}
 
-		storeImpl, err := v.storeBuilder(hash, v.logger)
+		key := storeKey(domain, clientID, audience, v.scopes)
+		storeImpl, err := v.storeBuilder(key, metadata, v.logger)
 		if err != nil {
 			return nil, errors.Wrap(err, "error building the store")
 		}
 		v.store = storeImpl
+
+		if v.secureStoreFactory != nil {
+			v.store = newSplitStore(key, storeImpl, v.secureStoreFactory, v.logger)
+		}
+
+		if v.hostBinding {
+			if err = v.bindStoreToHost(); err != nil {
+				return nil, err
+			}
+		}
+	} else if v.secureStoreFactory != nil {
+		return nil, errors.New("a secure store requires a store option too")
 	}
 
 	return v, nil
 }
 
+func storeKey(domain, clientID, audience string, scopes []string) string {
+	key := domain + "|" + clientID + "|" + audience
+	if len(scopes) > 0 {
+		// custom scopes get their own cache entry, default ones keep the original key
+		sorted := append([]string{}, scopes...)
+		sort.Strings(sorted)
+		key += "|" + strings.Join(sorted, " ")
+	}
+
+	h := md5.New()
+	h.Write([]byte(key))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
 type optionLogger struct {
 	value Logger
 }
@@ -132,6 +170,44 @@ func (o *optionDeviceConfirmPromptCallback) apply(target *DefaultImpl) error {
 	return nil
 }
 
+type optionJSONProgress struct {
+	value io.Writer
+}
+
+// WithJSONProgress emits a JSON line on w for every phase of the authorization flow,
+// so that wrapping tools can drive the login UX themselves.
+func WithJSONProgress(w io.Writer) Option {
+	return &optionJSONProgress{w}
+}
+
+func (o *optionJSONProgress) apply(target *DefaultImpl) error {
+	if o.value == nil {
+		target.progressWriter = nil
+		return nil
+	}
+	target.progressWriter = &jsonProgressWriter{
+		out: o.value,
+	}
+	return nil
+}
+
+// PollingProgressCallback is invoked after every unsuccessful poll for the token.
+// Returning an error aborts the authorization flow.
+type PollingProgressCallback func(PollingProgress) error
+
+type optionPollingProgressCallback struct {
+	value PollingProgressCallback
+}
+
+func WithPollingProgressCallback(callback PollingProgressCallback) Option {
+	return &optionPollingProgressCallback{callback}
+}
+
+func (o *optionPollingProgressCallback) apply(target *DefaultImpl) error {
+	target.pollingProgressCallback = o.value
+	return nil
+}
+
 type optionAutoOpenBrowser struct {
 	value bool
 }
@@ -145,6 +221,50 @@ func (o *optionAutoOpenBrowser) apply(target *DefaultImpl) error {
 	return nil
 }
 
+type optionBrowserOpener struct {
+	value BrowserOpener
+}
+
+// WithBrowserOpener replaces DefaultBrowserOpener. Headless detection is skipped for custom openers.
+func WithBrowserOpener(opener BrowserOpener) Option {
+	return &optionBrowserOpener{opener}
+}
+
+func (o *optionBrowserOpener) apply(target *DefaultImpl) error {
+	target.browserOpener = o.value
+	return nil
+}
+
+type optionHeadlessDetection struct {
+	value bool
+}
+
+// WithHeadlessDetection controls whether the browser is skipped in sessions
+// without a display (SSH, containers, non interactive shells). Enabled by default.
+func WithHeadlessDetection(headlessDetection bool) Option {
+	return &optionHeadlessDetection{headlessDetection}
+}
+
+func (o *optionHeadlessDetection) apply(target *DefaultImpl) error {
+	target.headlessDetection = o.value
+	return nil
+}
+
+type optionScopes struct {
+	value []string
+}
+
+// WithScopes replaces the default "profile email openid" scopes.
+// offline_access is still added when WithRequireOfflineAccess is enabled.
+func WithScopes(scopes ...string) Option {
+	return &optionScopes{scopes}
+}
+
+func (o *optionScopes) apply(target *DefaultImpl) error {
+	target.scopes = o.value
+	return nil
+}
+
 type optionRequireOfflineAccess struct {
 	value bool
 }
@@ -158,7 +278,39 @@ func (o *optionRequireOfflineAccess) apply(target *DefaultImpl) error {
 	return nil
 }
 
-type storeBuilder func(hash string, logger *loggerWrapper) (store, error)
+type optionRevokeOnLogout struct {
+	value bool
+}
+
+// WithRevokeOnLogout controls whether Logout revokes the refresh token on Auth0
+// before clearing the store. Enabled by default, disable it when working offline.
+func WithRevokeOnLogout(revokeOnLogout bool) Option {
+	return &optionRevokeOnLogout{revokeOnLogout}
+}
+
+func (o *optionRevokeOnLogout) apply(target *DefaultImpl) error {
+	target.revokeOnLogout = o.value
+	return nil
+}
+
+type optionBrowserLogout struct {
+	returnTo string
+}
+
+// WithBrowserLogout makes Logout also end the Auth0 browser session by opening /v2/logout,
+// so that the next login shows the account picker again.
+// returnTo is optional and must be listed in the allowed logout URLs of the application.
+func WithBrowserLogout(returnTo string) Option {
+	return &optionBrowserLogout{returnTo}
+}
+
+func (o *optionBrowserLogout) apply(target *DefaultImpl) error {
+	target.browserLogout = true
+	target.browserLogoutReturnTo = o.returnTo
+	return nil
+}
+
+type storeBuilder func(hash string, metadata SessionMetadata, logger *loggerWrapper) (Store, error)
 
 type optionStore struct {
 	storeBuilder storeBuilder
@@ -168,8 +320,32 @@ type optionStore struct {
 func WithAppDataStore(minDuration time.Duration) Option {
 	return &optionStore{
 		minDuration: minDuration,
-		storeBuilder: func(hash string, logger *loggerWrapper) (store, error) {
-			return newAppDataStore(hash, logger)
+		storeBuilder: func(hash string, metadata SessionMetadata, logger *loggerWrapper) (Store, error) {
+			return newAppDataStore(hash, metadata, logger)
+		},
+	}
+}
+
+// WithFileSystemStore keeps the authentication in the given directory.
+func WithFileSystemStore(dir string, minDuration time.Duration) Option {
+	return &optionStore{
+		minDuration: minDuration,
+		storeBuilder: func(hash string, metadata SessionMetadata, logger *loggerWrapper) (Store, error) {
+			return newFileSystemStore(hash, dir, &metadata, logger)
+		},
+	}
+}
+
+// WithStore keeps the authentication in the store built by the given factory,
+// invoked with a key identifying the tenant. The storetest package checks custom stores.
+func WithStore(factory StoreFactory, minDuration time.Duration) Option {
+	return &optionStore{
+		minDuration: minDuration,
+		storeBuilder: func(hash string, _ SessionMetadata, _ *loggerWrapper) (Store, error) {
+			if factory == nil {
+				return nil, errors.New("missing store factory")
+			}
+			return factory(hash)
 		},
 	}
 }
@@ -179,3 +355,70 @@ func (o *optionStore) apply(target *DefaultImpl) error {
 	target.storeBuilder = o.storeBuilder
 	return nil
 }
+
+type optionSecureStore struct {
+	value StoreFactory
+}
+
+// WithSecureStore keeps the refresh tokens in a store built by the given factory,
+// e.g. NewKeyringStoreFactory, while the rest of the authentication stays in the
+// store configured with the other options.
+func WithSecureStore(factory StoreFactory) Option {
+	return &optionSecureStore{factory}
+}
+
+func (o *optionSecureStore) apply(target *DefaultImpl) error {
+	target.secureStoreFactory = o.value
+	return nil
+}
+
+type optionHostBinding struct {
+	value bool
+}
+
+// WithHostBinding binds the cached sessions to the machine and the OS user that wrote them:
+// sessions found in a copied store directory are refused and removed.
+func WithHostBinding(enabled bool) Option {
+	return &optionHostBinding{enabled}
+}
+
+func (o *optionHostBinding) apply(target *DefaultImpl) error {
+	target.hostBinding = o.value
+	return nil
+}
+
+type optionStoreHousekeeping struct {
+	value HousekeepingPolicy
+}
+
+// WithStoreHousekeeping runs Housekeeping with the given policy in the background
+// every time a new authentication is saved in the store.
+func WithStoreHousekeeping(policy HousekeepingPolicy) Option {
+	return &optionStoreHousekeeping{policy}
+}
+
+func (o *optionStoreHousekeeping) apply(target *DefaultImpl) error {
+	policy := o.value
+	target.housekeepingPolicy = &policy
+	return nil
+}
+
+type optionAccessTokenDecryptionKey struct {
+	value []byte
+}
+
+// WithAccessTokenDecryptionKey decrypts JWE access tokens (RSA-OAEP-256 with A256GCM)
+// with the given RSA private key, PEM encoded, so that their claims can be read.
+// The encrypted token is still the one sent to the APIs.
+func WithAccessTokenDecryptionKey(pemKey []byte) Option {
+	return &optionAccessTokenDecryptionKey{pemKey}
+}
+
+func (o *optionAccessTokenDecryptionKey) apply(target *DefaultImpl) error {
+	key, err := parseRSAPrivateKey(o.value)
+	if err != nil {
+		return errors.Wrap(err, "invalid access token decryption key")
+	}
+	target.accessTokenDecryptionKey = key
+	return nil
+}
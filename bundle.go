@@ -0,0 +1,262 @@
+package auth0cliauthorizer
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"io"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/scrypt"
+)
+
+const (
+	bundleFormat  = "auth0-cli-auth-bundle"
+	bundleVersion = 1
+
+	// scrypt parameters recommended for interactive logins
+	bundleScryptN = 1 << 15
+	bundleScryptR = 8
+	bundleScryptP = 1
+)
+
+// sessionBundle is the encrypted envelope written by ExportSessions.
+type sessionBundle struct {
+	Format     string `json:"format"`
+	Version    int    `json:"version"`
+	KDF        string `json:"kdf"`
+	N          int    `json:"n"`
+	R          int    `json:"r"`
+	P          int    `json:"p"`
+	Salt       []byte `json:"salt"`
+	Nonce      []byte `json:"nonce"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+type sessionBundleContent struct {
+	ExportedAt time.Time            `json:"exported_at"`
+	Sessions   []sessionBundleEntry `json:"sessions"`
+}
+
+type sessionBundleEntry struct {
+	SessionMetadata
+	Active         bool           `json:"active"`
+	Authentication Authentication `json:"authentication"`
+}
+
+// ExportSessions writes the given cached sessions, as returned by ListCachedSessions,
+// to w in a bundle encrypted with the passphrase. Refresh tokens are left out
+// unless includeRefreshTokens is set: the imported sessions then last as long as their access token.
+func (a *DefaultImpl) ExportSessions(w io.Writer, passphrase string, sessions []CachedSession, includeRefreshTokens bool) error {
+	if passphrase == "" {
+		return errors.New("missing passphrase")
+	}
+
+	catalog, err := a.sessionCatalog()
+	if err != nil {
+		return err
+	}
+
+	content := sessionBundleContent{
+		ExportedAt: time.Now(),
+	}
+
+	for _, session := range sessions {
+		loaded, err := catalog.LoadSession(session)
+		if err != nil {
+			return errors.Wrapf(err, "error loading the cached session of %s", session.Email)
+		}
+		if loaded == nil {
+			continue
+		}
+		if session.Domain == "" || session.ClientID == "" {
+			return errors.Errorf("the cached session of %s belongs to an unknown tenant", session.Email)
+		}
+		if !includeRefreshTokens {
+			loaded.Tokens.RefreshToken = ""
+		}
+
+		content.Sessions = append(content.Sessions, sessionBundleEntry{
+			SessionMetadata: session.SessionMetadata,
+			Active:          session.Active,
+			Authentication:  *loaded,
+		})
+	}
+
+	bundle, err := sealSessionBundle(content, passphrase)
+	if err != nil {
+		return err
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err = encoder.Encode(bundle); err != nil {
+		return errors.Wrap(err, "error writing the bundle")
+	}
+
+	a.logger.Debugf("exported %d sessions", len(content.Sessions))
+	return nil
+}
+
+// ImportSessions reads a bundle written by ExportSessions and saves in the configured store
+// the sessions belonging to this tenant, returning them. Sessions of other tenants are skipped:
+// ErrBundleTenantMismatch is returned if none is left.
+func (a *DefaultImpl) ImportSessions(r io.Reader, passphrase string) ([]Authentication, error) {
+	if a.store == nil {
+		return nil, errors.New("missing store implementation")
+	}
+
+	var bundle sessionBundle
+	if err := json.NewDecoder(r).Decode(&bundle); err != nil {
+		return nil, errors.Wrap(err, "error reading the bundle")
+	}
+
+	content, err := openSessionBundle(bundle, passphrase)
+	if err != nil {
+		return nil, err
+	}
+
+	var matching []sessionBundleEntry
+	for _, entry := range content.Sessions {
+		if err = a.checkBundleEntry(entry); err != nil {
+			a.logger.Debugf("skipping the session of %s from the bundle: %v", entry.Authentication.User.Email, err)
+			continue
+		}
+		matching = append(matching, entry)
+	}
+	if len(matching) == 0 {
+		return nil, ErrBundleTenantMismatch
+	}
+
+	// the active session last, for stores keeping several accounts
+	var imported []Authentication
+	for _, active := range []bool{false, true} {
+		for _, entry := range matching {
+			if entry.Active != active {
+				continue
+			}
+			if err = a.store.Save(entry.Authentication); err != nil {
+				return imported, errors.Wrapf(err, "error saving the session of %s", entry.Authentication.User.Email)
+			}
+			imported = append(imported, entry.Authentication)
+		}
+	}
+
+	a.logger.Debugf("imported %d sessions", len(imported))
+	return imported, nil
+}
+
+// checkBundleEntry verifies that the entry belongs to this tenant,
+// both from its metadata and from the claims of its ID token.
+func (a *DefaultImpl) checkBundleEntry(entry sessionBundleEntry) error {
+	if !sameIssuer(entry.Domain, a.domain.String()) {
+		return errors.Errorf("issued by %s", entry.Domain)
+	}
+	if entry.ClientID != a.clientID {
+		return errors.Errorf("issued to client %s", entry.ClientID)
+	}
+	if entry.Audience != a.audience {
+		return errors.Errorf("issued for audience %s", entry.Audience)
+	}
+
+	if idToken := entry.Authentication.Tokens.IdToken; idToken != "" {
+		var claims idTokenContentDTO
+		if _, _, err := jwt.NewParser().ParseUnverified(idToken, &claims); err != nil {
+			return errors.Wrap(err, "error decoding identity token")
+		}
+		if !sameIssuer(claims.Issuer, a.domain.String()) {
+			return errors.Errorf("identity token issued by %s", claims.Issuer)
+		}
+		if !claims.VerifyAudience(a.clientID, true) {
+			return errors.New("identity token issued to another client")
+		}
+	}
+
+	return nil
+}
+
+func sealSessionBundle(content sessionBundleContent, passphrase string) (*sessionBundle, error) {
+	plaintext, err := json.Marshal(content)
+	if err != nil {
+		return nil, errors.Wrap(err, "error serializing the sessions")
+	}
+
+	bundle := &sessionBundle{
+		Format:  bundleFormat,
+		Version: bundleVersion,
+		KDF:     "scrypt",
+		N:       bundleScryptN,
+		R:       bundleScryptR,
+		P:       bundleScryptP,
+		Salt:    make([]byte, 16),
+	}
+	if _, err = io.ReadFull(rand.Reader, bundle.Salt); err != nil {
+		return nil, errors.Wrap(err, "error generating the salt")
+	}
+
+	aead, err := bundle.aead(passphrase)
+	if err != nil {
+		return nil, err
+	}
+
+	bundle.Nonce = make([]byte, aead.NonceSize())
+	if _, err = io.ReadFull(rand.Reader, bundle.Nonce); err != nil {
+		return nil, errors.Wrap(err, "error generating the nonce")
+	}
+	bundle.Ciphertext = aead.Seal(nil, bundle.Nonce, plaintext, []byte(bundleFormat))
+
+	return bundle, nil
+}
+
+func openSessionBundle(bundle sessionBundle, passphrase string) (*sessionBundleContent, error) {
+	if bundle.Format != bundleFormat {
+		return nil, errors.New("not a session bundle")
+	}
+	if bundle.Version != bundleVersion || bundle.KDF != "scrypt" {
+		return nil, errors.Errorf("unsupported bundle version %d", bundle.Version)
+	}
+	// the cost parameters come from the file: never derive a key that is more expensive than ours
+	if bundle.N <= 1 || bundle.N > bundleScryptN || bundle.R <= 0 || bundle.R > bundleScryptR ||
+		bundle.P <= 0 || bundle.P > bundleScryptP {
+		return nil, errors.Errorf("unsupported key derivation parameters N=%d r=%d p=%d", bundle.N, bundle.R, bundle.P)
+	}
+
+	aead, err := bundle.aead(passphrase)
+	if err != nil {
+		return nil, err
+	}
+	if len(bundle.Nonce) != aead.NonceSize() {
+		return nil, ErrWrongPassphrase
+	}
+
+	plaintext, err := aead.Open(nil, bundle.Nonce, bundle.Ciphertext, []byte(bundleFormat))
+	if err != nil {
+		return nil, ErrWrongPassphrase
+	}
+
+	var content sessionBundleContent
+	if err = json.Unmarshal(plaintext, &content); err != nil {
+		return nil, errors.Wrap(err, "error deserializing the sessions")
+	}
+	return &content, nil
+}
+
+func (b *sessionBundle) aead(passphrase string) (cipher.AEAD, error) {
+	if passphrase == "" {
+		return nil, errors.New("missing passphrase")
+	}
+
+	key, err := scrypt.Key([]byte(passphrase), b.Salt, b.N, b.R, b.P, 32)
+	if err != nil {
+		return nil, errors.Wrap(err, "error deriving the key from the passphrase")
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, errors.Wrap(err, "error building the cipher")
+	}
+	return cipher.NewGCM(block)
+}
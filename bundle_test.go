@@ -0,0 +1,226 @@
+package auth0cliauthorizer
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+)
+
+func testBundleContent() sessionBundleContent {
+	return sessionBundleContent{
+		ExportedAt: time.Now().UTC().Truncate(time.Second),
+		Sessions: []sessionBundleEntry{
+			{
+				SessionMetadata: SessionMetadata{Domain: "tenant.eu.auth0.com", ClientID: "client", Audience: "https://api"},
+				Active:          true,
+				Authentication: Authentication{
+					Tokens: Tokens{AccessToken: "access", RefreshToken: "refresh"},
+				},
+			},
+		},
+	}
+}
+
+func TestSessionBundleRoundTrip(t *testing.T) {
+	bundle, err := sealSessionBundle(testBundleContent(), "passphrase")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := openSessionBundle(*bundle, "passphrase")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(content.Sessions) != 1 || content.Sessions[0].Authentication.Tokens.RefreshToken != "refresh" ||
+		content.Sessions[0].ClientID != "client" || !content.Sessions[0].Active {
+		t.Fatalf("unexpected content after round trip: %+v", content)
+	}
+}
+
+func TestSessionBundleWrongPassphrase(t *testing.T) {
+	bundle, err := sealSessionBundle(testBundleContent(), "passphrase")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = openSessionBundle(*bundle, "another passphrase"); err != ErrWrongPassphrase {
+		t.Fatalf("expected ErrWrongPassphrase, got %v", err)
+	}
+}
+
+func TestSessionBundleTamperedCiphertext(t *testing.T) {
+	bundle, err := sealSessionBundle(testBundleContent(), "passphrase")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bundle.Ciphertext[len(bundle.Ciphertext)/2] ^= 0xff
+
+	if _, err = openSessionBundle(*bundle, "passphrase"); err != ErrWrongPassphrase {
+		t.Fatalf("expected ErrWrongPassphrase, got %v", err)
+	}
+}
+
+func TestSessionBundleOversizedParameters(t *testing.T) {
+	for name, tamper := range map[string]func(b *sessionBundle){
+		"N":    func(b *sessionBundle) { b.N = 1 << 24 },
+		"r":    func(b *sessionBundle) { b.R = 1 << 10 },
+		"p":    func(b *sessionBundle) { b.P = 1 << 10 },
+		"zero": func(b *sessionBundle) { b.N, b.R, b.P = 0, 0, 0 },
+	} {
+		t.Run(name, func(t *testing.T) {
+			bundle, err := sealSessionBundle(testBundleContent(), "passphrase")
+			if err != nil {
+				t.Fatal(err)
+			}
+			tamper(bundle)
+
+			if _, err = openSessionBundle(*bundle, "passphrase"); err == nil || err == ErrWrongPassphrase {
+				t.Fatalf("expected the parameters to be refused, got %v", err)
+			}
+		})
+	}
+}
+
+// newBundleTestAuthorizer builds an authorizer for f with the given client,
+// keeping its sessions in dir.
+func newBundleTestAuthorizer(t *testing.T, f *fakeAuth0, clientID, dir string) *DefaultImpl {
+	a, err := New(f.srv.URL, clientID, "https://api", WithLogger(nil), WithAutoOpenBrowser(false),
+		WithFileSystemStore(dir, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return a
+}
+
+func testBundleAuthentication(f *fakeAuth0) Authentication {
+	return Authentication{
+		User: User{Sub: f.sub, Email: "alice@example.com"},
+		Tokens: Tokens{
+			AccessToken:  f.signedAccessToken(f.srv.URL+"/", "https://api"),
+			RefreshToken: "refresh-token",
+			IdToken:      f.signedIdToken(f.srv.URL + "/"),
+			ExpiresAt:    time.Now().Add(time.Hour).UTC().Truncate(time.Second),
+		},
+	}
+}
+
+// exportTestBundle exports every session cached by source.
+func exportTestBundle(t *testing.T, source *DefaultImpl, includeRefreshTokens bool) *bytes.Buffer {
+	sessions, err := source.ListCachedSessions()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var exported bytes.Buffer
+	if err = source.ExportSessions(&exported, "passphrase", sessions, includeRefreshTokens); err != nil {
+		t.Fatal(err)
+	}
+	return &exported
+}
+
+func TestExportImportSessions(t *testing.T) {
+	for name, includeRefreshTokens := range map[string]bool{"with refresh tokens": true, "without refresh tokens": false} {
+		t.Run(name, func(t *testing.T) {
+			f := newFakeAuth0(t)
+			source := newBundleTestAuthorizer(t, f, "client", t.TempDir())
+			authentication := testBundleAuthentication(f)
+			if err := source.store.Save(authentication); err != nil {
+				t.Fatal(err)
+			}
+			exported := exportTestBundle(t, source, includeRefreshTokens)
+
+			target := newBundleTestAuthorizer(t, f, "client", t.TempDir())
+			imported, err := target.ImportSessions(exported, "passphrase")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(imported) != 1 {
+				t.Fatalf("expected one imported session, got %d", len(imported))
+			}
+
+			loaded, err := target.store.Load()
+			if err != nil || loaded == nil {
+				t.Fatalf("expected the session in the target store, got %v, %v", loaded, err)
+			}
+			expected := authentication.Tokens
+			if !includeRefreshTokens {
+				expected.RefreshToken = ""
+			}
+			if loaded.Tokens.AccessToken != expected.AccessToken || loaded.Tokens.RefreshToken != expected.RefreshToken ||
+				loaded.Tokens.IdToken != expected.IdToken || !loaded.Tokens.ExpiresAt.Equal(expected.ExpiresAt) ||
+				loaded.User.Email != authentication.User.Email {
+				t.Fatalf("expected %+v to be imported, got %+v", expected, loaded.Tokens)
+			}
+		})
+	}
+}
+
+func TestImportSessionsSkipsOtherTenants(t *testing.T) {
+	f := newFakeAuth0(t)
+	dir := t.TempDir()
+	source := newBundleTestAuthorizer(t, f, "client", dir)
+	if err := source.store.Save(testBundleAuthentication(f)); err != nil {
+		t.Fatal(err)
+	}
+	// another client sharing the store directory, listed and exported too
+	other := newBundleTestAuthorizer(t, f, "other-client", dir)
+	otherAuthentication := testBundleAuthentication(f)
+	otherAuthentication.Tokens.RefreshToken = "other-refresh-token"
+	if err := other.store.Save(otherAuthentication); err != nil {
+		t.Fatal(err)
+	}
+	exported := exportTestBundle(t, source, true).Bytes()
+
+	target := newBundleTestAuthorizer(t, f, "client", t.TempDir())
+	imported, err := target.ImportSessions(bytes.NewReader(exported), "passphrase")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(imported) != 1 || imported[0].Tokens.RefreshToken != "refresh-token" {
+		t.Fatalf("expected only the session of this client to be imported, got %+v", imported)
+	}
+
+	// no session of the bundle belongs to another tenant
+	g := newFakeAuth0(t)
+	for name, target := range map[string]*DefaultImpl{
+		"another domain": newBundleTestAuthorizer(t, g, "client", t.TempDir()),
+		"another client": newBundleTestAuthorizer(t, f, "third-client", t.TempDir()),
+	} {
+		t.Run(name, func(t *testing.T) {
+			if _, err := target.ImportSessions(bytes.NewReader(exported), "passphrase"); err != ErrBundleTenantMismatch {
+				t.Fatalf("expected ErrBundleTenantMismatch, got %v", err)
+			}
+			if loaded, err := target.store.Load(); err != nil || loaded != nil {
+				t.Fatalf("expected the target store to stay empty, got %v, %v", loaded, err)
+			}
+		})
+	}
+}
+
+func TestImportSessionsWrongPassphrase(t *testing.T) {
+	f := newFakeAuth0(t)
+	source := newBundleTestAuthorizer(t, f, "client", t.TempDir())
+	if err := source.store.Save(testBundleAuthentication(f)); err != nil {
+		t.Fatal(err)
+	}
+	exported := exportTestBundle(t, source, true)
+
+	target := newBundleTestAuthorizer(t, f, "client", t.TempDir())
+	existing := testBundleAuthentication(f)
+	existing.Tokens.RefreshToken = "existing-refresh-token"
+	if err := target.store.Save(existing); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := target.ImportSessions(exported, "another passphrase"); err != ErrWrongPassphrase {
+		t.Fatalf("expected ErrWrongPassphrase, got %v", err)
+	}
+	loaded, err := target.store.Load()
+	if err != nil || loaded == nil || loaded.Tokens.RefreshToken != "existing-refresh-token" {
+		t.Fatalf("expected the target store to be left untouched, got %v, %v", loaded, err)
+	}
+	if _, err = target.Authorize(context.Background()); err != nil {
+		t.Fatalf("expected the existing session to still be usable, got %v", err)
+	}
+}
@@ -1,8 +1,104 @@
 package auth0cliauthorizer
 
+import (
+	"sync"
+	"time"
+)
+
 type DeviceConfirmPrompt struct {
-	DeviceCode              string `json:"device_code"`
-	VerificationUri         string `json:"verification_uri"`
-	VerificationUriComplete string `json:"verification_uri_complete"`
-	ExpiresIn               int    `json:"expires_in"`
+	DeviceCode              string    `json:"device_code"`
+	UserCode                string    `json:"user_code"`
+	VerificationUri         string    `json:"verification_uri"`
+	VerificationUriComplete string    `json:"verification_uri_complete"`
+	ExpiresIn               int       `json:"expires_in"`
+	ExpiresAt               time.Time `json:"expires_at"`
+
+	outcome *promptOutcome
+}
+
+// Done returns a channel that is closed once the authorization flow
+// this prompt belongs to has completed, either successfully or not.
+func (p DeviceConfirmPrompt) Done() <-chan struct{} {
+	if p.outcome == nil {
+		return nil
+	}
+	return p.outcome.done
+}
+
+// Err returns the outcome of the authorization flow after Done is closed:
+// nil if the user confirmed the device and the tokens were issued.
+func (p DeviceConfirmPrompt) Err() error {
+	if p.outcome == nil {
+		return nil
+	}
+	select {
+	case <-p.outcome.done:
+		return p.outcome.err
+	default:
+		return nil
+	}
+}
+
+type promptOutcome struct {
+	done chan struct{}
+	once sync.Once
+	err  error
+	// watchers are the goroutines of the prompt following the flow
+	watchers sync.WaitGroup
+	// logger is the authorizer one, whose output the prompt can take over while showing
+	logger *loggerWrapper
+}
+
+func newPromptOutcome(logger *loggerWrapper) *promptOutcome {
+	return &promptOutcome{
+		done:   make(chan struct{}),
+		logger: logger,
+	}
+}
+
+// watch runs f in a goroutine that complete waits for.
+func (o *promptOutcome) watch(f func()) {
+	o.watchers.Add(1)
+	go func() {
+		defer o.watchers.Done()
+		f()
+	}()
+}
+
+// takeOverLogs routes the log output through around until release is called,
+// so that the prompt can keep its own output consistent.
+func (o *promptOutcome) takeOverLogs(around func(log func())) (release func()) {
+	if o.logger == nil {
+		return func() {}
+	}
+	o.logger.setAround(around)
+	return func() {
+		o.logger.setAround(nil)
+	}
+}
+
+// complete records the outcome of the flow and waits for the prompt to be done with the terminal.
+func (o *promptOutcome) complete(err error) {
+	o.once.Do(func() {
+		o.err = err
+		close(o.done)
+	})
+	o.watchers.Wait()
+}
+
+type PollingStatus string
+
+const (
+	PollingStatusPending        PollingStatus = "pending"
+	PollingStatusSlowDown       PollingStatus = "slow_down"
+	PollingStatusTransientError PollingStatus = "transient_error"
+)
+
+type PollingProgress struct {
+	Status  PollingStatus
+	Attempt int
+	// Interval is the effective polling interval, already increased after a slow_down.
+	Interval   time.Duration
+	NextPollAt time.Time
+	Err        error
 }
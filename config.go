@@ -0,0 +1,272 @@
+package auth0cliauthorizer
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	EnvDomain   = "AUTH0_DOMAIN"
+	EnvClientID = "AUTH0_CLIENT_ID"
+	EnvAudience = "AUTH0_AUDIENCE"
+	EnvScopes   = "AUTH0_SCOPES"
+	EnvProfile  = "AUTH0_PROFILE"
+	EnvStoreURL = "AUTH0_STORE_URL"
+)
+
+const (
+	configFileBaseName = "auth"
+	envProfileName     = "default"
+)
+
+type configFile struct {
+	DefaultProfile string                   `yaml:"default_profile" toml:"default_profile"`
+	Profiles       map[string]configProfile `yaml:"profiles" toml:"profiles"`
+}
+
+type configProfile struct {
+	Domain   string      `yaml:"domain" toml:"domain"`
+	ClientID string      `yaml:"client_id" toml:"client_id"`
+	Audience string      `yaml:"audience" toml:"audience"`
+	Scopes   []string    `yaml:"scopes" toml:"scopes"`
+	Store    configStore `yaml:"store" toml:"store"`
+}
+
+type configStore struct {
+	Disabled    bool   `yaml:"disabled" toml:"disabled"`
+	URL         string `yaml:"url" toml:"url"`
+	Dir         string `yaml:"dir" toml:"dir"`
+	MinDuration string `yaml:"min_duration" toml:"min_duration"`
+}
+
+// NewFromConfig builds a Manager from $XDG_CONFIG_HOME/<app>/auth.yaml (or auth.yml, auth.toml).
+//
+// Settings are applied in this order, later ones winning:
+// the given options, the config file, the AUTH0_* environment variables.
+// The environment variables apply to the profile selected by AUTH0_PROFILE,
+// or to the default one; without a config file they define a single "default" profile.
+func NewFromConfig(app string, options ...Option) (*Manager, error) {
+	if app == "" {
+		return nil, errors.New("missing app name")
+	}
+
+	configDir := os.Getenv("XDG_CONFIG_HOME")
+	if configDir == "" {
+		var err error
+		configDir, err = os.UserConfigDir()
+		if err != nil {
+			return nil, errors.Wrap(err, "error detecting the user config dir")
+		}
+	}
+
+	config, err := readConfigFile(filepath.Join(configDir, app))
+	if err != nil {
+		return nil, err
+	}
+
+	profiles, defaultProfile, err := config.toProfiles()
+	if err != nil {
+		return nil, err
+	}
+
+	if selected := os.Getenv(EnvProfile); selected != "" {
+		defaultProfile = selected
+	}
+
+	profiles, defaultProfile, err = applyEnvToProfiles(profiles, defaultProfile)
+	if err != nil {
+		return nil, err
+	}
+	if len(profiles) == 0 {
+		return nil, errors.Errorf("no profiles defined in the config file nor in the %s environment variable", EnvDomain)
+	}
+
+	m, err := NewManager(profiles, options...)
+	if err != nil {
+		return nil, err
+	}
+
+	if defaultProfile != "" {
+		if _, err = m.Authorizer(defaultProfile); err != nil {
+			return nil, errors.Wrap(err, "error selecting the default profile")
+		}
+		m.defaultProfile = defaultProfile
+	}
+
+	return m, nil
+}
+
+// NewFromEnv builds an authorizer from the AUTH0_* environment variables,
+// which take precedence over the given options.
+func NewFromEnv(options ...Option) (*DefaultImpl, error) {
+	options = append([]Option{}, options...)
+	if scopes := parseScopes(os.Getenv(EnvScopes)); len(scopes) > 0 {
+		options = append(options, WithScopes(scopes...))
+	}
+	if storeURL := os.Getenv(EnvStoreURL); storeURL != "" {
+		options = append(options, &optionStoreBackendURL{storeURL})
+	}
+
+	return New(os.Getenv(EnvDomain), os.Getenv(EnvClientID), os.Getenv(EnvAudience), options...)
+}
+
+func readConfigFile(dir string) (*configFile, error) {
+	for _, ext := range []string{".yaml", ".yml", ".toml"} {
+		p := filepath.Join(dir, configFileBaseName+ext)
+		if !checkFileExists(p) {
+			continue
+		}
+
+		content, err := os.ReadFile(p)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error reading config file %s", p)
+		}
+
+		var config configFile
+		if ext == ".toml" {
+			err = toml.Unmarshal(content, &config)
+		} else {
+			err = yaml.Unmarshal(content, &config)
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "error parsing config file %s", p)
+		}
+
+		return &config, nil
+	}
+
+	return &configFile{}, nil
+}
+
+func (c *configFile) toProfiles() ([]Profile, string, error) {
+	names := make([]string, 0, len(c.Profiles))
+	for name := range c.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	profiles := make([]Profile, 0, len(names))
+	for _, name := range names {
+		entry := c.Profiles[name]
+
+		profile := Profile{
+			Name:     name,
+			Domain:   entry.Domain,
+			ClientID: entry.ClientID,
+			Audience: entry.Audience,
+			Scopes:   entry.Scopes,
+			Store: ProfileStore{
+				Disabled: entry.Store.Disabled,
+				URL:      entry.Store.URL,
+				Dir:      entry.Store.Dir,
+			},
+		}
+
+		if entry.Store.MinDuration != "" {
+			minDuration, err := time.ParseDuration(entry.Store.MinDuration)
+			if err != nil {
+				return nil, "", errors.Wrapf(err, "invalid store min_duration for profile %s", name)
+			}
+			profile.Store.MinDuration = minDuration
+		}
+
+		profiles = append(profiles, profile)
+	}
+
+	defaultProfile := c.DefaultProfile
+	if defaultProfile == "" && len(profiles) == 1 {
+		defaultProfile = profiles[0].Name
+	}
+
+	return profiles, defaultProfile, nil
+}
+
+// applyEnvToProfiles overrides the default profile with the environment variables.
+// With several profiles the target must be named, by AUTH0_PROFILE or by the config file.
+func applyEnvToProfiles(profiles []Profile, defaultProfile string) ([]Profile, string, error) {
+	domain := os.Getenv(EnvDomain)
+	clientID := os.Getenv(EnvClientID)
+	audience := os.Getenv(EnvAudience)
+	scopes := parseScopes(os.Getenv(EnvScopes))
+	storeURL := os.Getenv(EnvStoreURL)
+
+	if domain == "" && clientID == "" && audience == "" && len(scopes) == 0 && storeURL == "" {
+		return profiles, defaultProfile, nil
+	}
+
+	if len(profiles) == 0 {
+		if domain == "" && clientID == "" && audience == "" && len(scopes) == 0 {
+			// the store alone does not make a profile
+			return profiles, defaultProfile, nil
+		}
+		if defaultProfile == "" {
+			defaultProfile = envProfileName
+		}
+		profiles = append(profiles, Profile{
+			Name: defaultProfile,
+		})
+	} else if defaultProfile == "" {
+		if len(profiles) > 1 {
+			return nil, "", errors.Errorf("several profiles are defined: set %s or default_profile "+
+				"to select the one the environment variables apply to", EnvProfile)
+		}
+		defaultProfile = profiles[0].Name
+	}
+
+	found := false
+	for i := range profiles {
+		if profiles[i].Name != defaultProfile {
+			continue
+		}
+		found = true
+		if domain != "" {
+			profiles[i].Domain = domain
+		}
+		if clientID != "" {
+			profiles[i].ClientID = clientID
+		}
+		if audience != "" {
+			profiles[i].Audience = audience
+		}
+		if len(scopes) > 0 {
+			profiles[i].Scopes = scopes
+		}
+		if storeURL != "" {
+			profiles[i].Store.URL = storeURL
+			profiles[i].Store.Disabled = false
+		}
+	}
+	if !found {
+		return nil, "", errors.Errorf("unknown profile %s, the environment variables can't be applied", defaultProfile)
+	}
+
+	return profiles, defaultProfile, nil
+}
+
+func parseScopes(value string) []string {
+	return strings.FieldsFunc(value, func(r rune) bool {
+		return r == ' ' || r == ',' || r == '\t'
+	})
+}
+
+// optionStoreBackendURL replaces the store backend, keeping the min duration
+// set by the options given in code.
+type optionStoreBackendURL struct {
+	url string
+}
+
+func (o *optionStoreBackendURL) apply(target *DefaultImpl) error {
+	builder, err := storeBuilderFromURL(o.url)
+	if err != nil {
+		return errors.Wrapf(err, "invalid %s", EnvStoreURL)
+	}
+	target.storeBuilder = builder
+	return nil
+}
@@ -0,0 +1,77 @@
+package auth0cliauthorizer
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const testConfig = `
+profiles:
+  dev:
+    domain: https://dev.eu.auth0.com
+    client_id: devClient
+    audience: https://api
+  prod:
+    domain: https://prod.eu.auth0.com
+    client_id: prodClient
+    audience: https://api
+`
+
+func setupTestConfig(t *testing.T, config string) {
+	configDir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(configDir, "mycli"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(configDir, "mycli", "auth.yaml"), []byte(config), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("XDG_CONFIG_HOME", configDir)
+	t.Setenv(EnvStoreDir, t.TempDir())
+	for _, name := range []string{EnvDomain, EnvClientID, EnvAudience, EnvScopes, EnvProfile, EnvStoreURL} {
+		t.Setenv(name, "")
+	}
+}
+
+func TestConfigEnvAppliesToSelectedProfile(t *testing.T) {
+	setupTestConfig(t, testConfig)
+	t.Setenv(EnvProfile, "prod")
+	t.Setenv(EnvClientID, "overriddenClient")
+
+	manager, err := NewFromConfig("mycli", WithLogger(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	prod, err := manager.Authorizer("prod")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dev, err := manager.Authorizer("dev")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if prod.clientID != "overriddenClient" || dev.clientID != "devClient" {
+		t.Fatalf("expected the override on prod only, got %s and %s", prod.clientID, dev.clientID)
+	}
+}
+
+func TestConfigEnvRequiresProfileSelection(t *testing.T) {
+	setupTestConfig(t, testConfig)
+	t.Setenv(EnvClientID, "overriddenClient")
+
+	if _, err := NewFromConfig("mycli", WithLogger(nil)); err == nil {
+		t.Fatal("expected an error with several profiles and none selected")
+	}
+}
+
+func TestConfigEnvUnknownProfile(t *testing.T) {
+	setupTestConfig(t, testConfig)
+	t.Setenv(EnvProfile, "staging")
+	t.Setenv(EnvClientID, "overriddenClient")
+
+	if _, err := NewFromConfig("mycli", WithLogger(nil)); err == nil {
+		t.Fatal("expected an error for an unknown profile")
+	}
+}
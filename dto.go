@@ -38,6 +38,7 @@ type idTokenContentDTO struct {
 	Email         string    `json:"email"`
 	EmailVerified bool      `json:"email_verified"`
 	UpdatedAt     time.Time `json:"updated_at"`
+	Permissions   []string  `json:"permissions"`
 }
 
 type userInfoResponseDTO struct {
@@ -62,7 +63,8 @@ type userInfoResponseDTO struct {
 	Address             struct {
 		Country string `json:"country"`
 	} `json:"address"`
-	UpdatedAt string `json:"updated_at"`
+	UpdatedAt   string   `json:"updated_at"`
+	Permissions []string `json:"permissions"`
 }
 
 type refreshTokenResponseDTO struct {
@@ -0,0 +1,113 @@
+package auth0cliauthorizer
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+)
+
+// not ending with .json, so that the entries are never mistaken for sessions
+const encryptedFileSuffix = ".json.enc"
+
+type encryptedFileStore struct {
+	path string
+	key  [32]byte
+}
+
+var _ Store = &encryptedFileStore{}
+
+// NewEncryptedFileStoreFactory keeps the entries in dir, encrypted with AES-256-GCM
+// using a key derived from the given secret, e.g. the content of a key file.
+func NewEncryptedFileStoreFactory(dir string, secret []byte) StoreFactory {
+	return func(key string) (Store, error) {
+		if dir == "" || key == "" {
+			return nil, errors.New("missing directory or key")
+		}
+		if len(secret) == 0 {
+			return nil, errors.New("missing encryption secret")
+		}
+
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return nil, errors.Errorf("could not create directory %s", dir)
+		}
+
+		return &encryptedFileStore{
+			path: filepath.Join(dir, key+encryptedFileSuffix),
+			key:  sha256.Sum256(secret),
+		}, nil
+	}
+}
+
+func (e *encryptedFileStore) aead() (cipher.AEAD, error) {
+	block, err := aes.NewCipher(e.key[:])
+	if err != nil {
+		return nil, errors.Wrap(err, "error building the cipher")
+	}
+	return cipher.NewGCM(block)
+}
+
+func (e *encryptedFileStore) Save(authentication Authentication) error {
+	serialized, err := json.Marshal(authentication)
+	if err != nil {
+		return errors.Wrap(err, "error serializing authentication")
+	}
+
+	aead, err := e.aead()
+	if err != nil {
+		return err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err = io.ReadFull(rand.Reader, nonce); err != nil {
+		return errors.Wrap(err, "error generating the nonce")
+	}
+
+	if err = writeFileAtomic(e.path, aead.Seal(nonce, nonce, serialized, nil), 0600); err != nil {
+		return errors.Wrap(err, "error writing to file")
+	}
+	return nil
+}
+
+func (e *encryptedFileStore) Load() (*Authentication, error) {
+	encrypted, err := os.ReadFile(e.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "error reading from file")
+	}
+
+	aead, err := e.aead()
+	if err != nil {
+		return nil, err
+	}
+	if len(encrypted) < aead.NonceSize() {
+		return nil, errors.New("encrypted file is truncated")
+	}
+
+	nonce, ciphertext := encrypted[:aead.NonceSize()], encrypted[aead.NonceSize():]
+	serialized, err := aead.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "error decrypting the file, was the secret changed?")
+	}
+
+	var authentication Authentication
+	if err = json.Unmarshal(serialized, &authentication); err != nil {
+		return nil, errors.Wrap(err, "error deserializing authentication")
+	}
+	return &authentication, nil
+}
+
+func (e *encryptedFileStore) Clear() error {
+	if err := removeIfExists(e.path); err != nil {
+		return errors.Wrap(err, "error removing encrypted file")
+	}
+	return nil
+}
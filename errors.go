@@ -2,6 +2,19 @@ package auth0cliauthorizer
 
 import (
 	"fmt"
+	"net"
+	"net/http"
+
+	"github.com/pkg/errors"
+)
+
+const maxConsecutiveTransientPollingErrors = 5
+
+var (
+	ErrAccountNotFound      = errors.New("account not found")
+	ErrAccountsNotSupported = errors.New("the configured store does not support multiple accounts")
+	ErrWrongPassphrase      = errors.New("wrong passphrase or corrupted bundle")
+	ErrBundleTenantMismatch = errors.New("the bundle holds no session for this tenant")
 )
 
 var (
@@ -35,3 +48,35 @@ type managedHTTPError struct {
 func (e *managedHTTPError) Error() string {
 	return fmt.Sprintf("Error: %s (%s)", e.ErrorCode, e.ErrorDescription)
 }
+
+type httpStatusError struct {
+	StatusCode int
+	Status     string
+}
+
+func (e *httpStatusError) Error() string {
+	return fmt.Sprintf("error %d (%s)", e.StatusCode, e.Status)
+}
+
+func isTransientError(err error) bool {
+	var statusErr *httpStatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode >= http.StatusInternalServerError || statusErr.StatusCode == http.StatusTooManyRequests
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// RevocationError is returned by Logout when the local session was cleared
+// but the refresh token could not be revoked on the server.
+type RevocationError struct {
+	Err error
+}
+
+func (e *RevocationError) Error() string {
+	return fmt.Sprintf("error revoking refresh token: %v", e.Err)
+}
+
+func (e *RevocationError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,84 @@
+package auth0cliauthorizer
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"os/exec"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+type execStore struct {
+	command string
+	args    []string
+	key     string
+}
+
+var _ Store = &execStore{}
+
+// NewExecStoreFactory delegates to an external helper, much like git credential helpers.
+// The command is run with "get <key>", "store <key>" or "erase <key>" appended to args:
+// "store" receives the authentication as JSON on stdin, "get" prints it on stdout
+// or prints nothing if there is none.
+func NewExecStoreFactory(command string, args ...string) StoreFactory {
+	return func(key string) (Store, error) {
+		if command == "" || key == "" {
+			return nil, errors.New("missing command or key")
+		}
+		return &execStore{
+			command: command,
+			args:    args,
+			key:     key,
+		}, nil
+	}
+}
+
+func (e *execStore) run(action string, stdin io.Reader) ([]byte, error) {
+	cmd := exec.Command(e.command, append(append([]string{}, e.args...), action, e.key)...)
+	cmd.Stdin = stdin
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		if message := strings.TrimSpace(stderr.String()); message != "" {
+			return nil, errors.Wrapf(err, "store helper %s %s failed: %s", e.command, action, message)
+		}
+		return nil, errors.Wrapf(err, "store helper %s %s failed", e.command, action)
+	}
+	return stdout.Bytes(), nil
+}
+
+func (e *execStore) Save(authentication Authentication) error {
+	serialized, err := json.Marshal(authentication)
+	if err != nil {
+		return errors.Wrap(err, "error serializing authentication")
+	}
+
+	_, err = e.run("store", bytes.NewReader(serialized))
+	return err
+}
+
+func (e *execStore) Load() (*Authentication, error) {
+	serialized, err := e.run("get", nil)
+	if err != nil {
+		return nil, err
+	}
+	if len(bytes.TrimSpace(serialized)) == 0 {
+		return nil, nil
+	}
+
+	var authentication Authentication
+	if err = json.Unmarshal(serialized, &authentication); err != nil {
+		return nil, errors.Wrap(err, "error deserializing authentication")
+	}
+	return &authentication, nil
+}
+
+func (e *execStore) Clear() error {
+	_, err := e.run("erase", nil)
+	return err
+}
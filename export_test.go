@@ -0,0 +1,27 @@
+package auth0cliauthorizer
+
+func NewFileSystemStoreForTest(tenant, dir string) (Store, error) {
+	return newFileSystemStore(tenant, dir, &SessionMetadata{}, &loggerWrapper{underlying: &noOpLogger{}})
+}
+
+func NewAppDataStoreForTest(tenant string) (Store, error) {
+	return newAppDataStore(tenant, SessionMetadata{}, &loggerWrapper{underlying: &noOpLogger{}})
+}
+
+func NewSplitStoreForTest(tenant string, primary Store, secure StoreFactory) Store {
+	return newSplitStore(tenant, primary, secure, &loggerWrapper{underlying: &noOpLogger{}})
+}
+
+type SessionCatalogForTest = sessionCatalog
+
+func BindToHostForTest(store Store, fingerprint string) error {
+	bindable, ok := store.(hostBindableStore)
+	if !ok {
+		return errHostBindingNotSupported
+	}
+	return bindable.bindToHost(hostBinding{fingerprint: fingerprint})
+}
+
+const CurrentSchemaVersionForTest = currentSchemaVersion
+
+type AccountStoreForTest = accountStore
@@ -0,0 +1,134 @@
+package auth0cliauthorizer
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"os/exec"
+	"os/user"
+	"regexp"
+	"runtime"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// hostBindableStore is implemented by stores able to record the host fingerprint
+// in their entries and to refuse the entries written elsewhere.
+type hostBindableStore interface {
+	bindToHost(binding hostBinding) error
+}
+
+// hostBinding decides which stored entries may be used on this host.
+type hostBinding struct {
+	fingerprint string
+	// onRefused is called after an entry written elsewhere has been removed,
+	// so that a wrapping store can remove what it keeps for the same entry
+	onRefused func(key string, authentication Authentication)
+}
+
+// accepts tells whether the entry may be used on this host.
+// Entries written without the binding are accepted.
+func (b hostBinding) accepts(envelope *storageEnvelope) bool {
+	return b.fingerprint == "" || envelope.HostFingerprint == "" || envelope.HostFingerprint == b.fingerprint
+}
+
+// refuse removes the entry stored in p, written on another host.
+func (b hostBinding) refuse(p, key string, authentication Authentication, logger *loggerWrapper) {
+	logger.Warningf("refusing authentication stored in %s: it was written on another machine or by another user", p)
+	if err := removeIfExists(p); err != nil {
+		logger.Warningf("error removing the refused authentication: %v", err)
+	}
+	if b.onRefused != nil {
+		b.onRefused(key, authentication)
+	}
+}
+
+var (
+	errHostBindingNotSupported = errors.New("the configured store does not support host binding")
+	errSessionBoundElsewhere   = errors.New("the session was written on another machine or by another user")
+)
+
+// machineIDFiles are read in order on the systems other than darwin and windows.
+var machineIDFiles = []string{"/etc/machine-id", "/var/lib/dbus/machine-id", "/etc/hostid"}
+
+var (
+	darwinPlatformUUID  = regexp.MustCompile(`"IOPlatformUUID" = "([^"]+)"`)
+	windowsMachineGUIDs = regexp.MustCompile(`MachineGuid\s+REG_SZ\s+(\S+)`)
+)
+
+func (a *DefaultImpl) bindStoreToHost() error {
+	bindable, ok := a.store.(hostBindableStore)
+	if !ok {
+		return errHostBindingNotSupported
+	}
+
+	fingerprint, err := hostFingerprint(a.logger)
+	if err != nil {
+		return errors.Wrap(err, "error computing the host fingerprint")
+	}
+	return bindable.bindToHost(hostBinding{fingerprint: fingerprint})
+}
+
+// hostFingerprint identifies the machine and the OS user, without disclosing either.
+// The hostname stands in for the machine id where none is available (minimal containers, some BSDs).
+// hostnameFallbackWarning is shown once per process, as every New computes the fingerprint.
+var hostnameFallbackWarning sync.Once
+
+func hostFingerprint(logger *loggerWrapper) (string, error) {
+	machine, err := machineID()
+	if err != nil {
+		hostname, hostnameErr := os.Hostname()
+		if hostnameErr != nil || hostname == "" {
+			return "", errors.Wrap(err, "error detecting the machine id")
+		}
+		hostnameFallbackWarning.Do(func() {
+			logger.Warningf("no machine id available (%v), binding the sessions to the hostname %s instead", err, hostname)
+		})
+		machine = "hostname:" + hostname
+	}
+
+	current, err := user.Current()
+	if err != nil {
+		return "", errors.Wrap(err, "error detecting the current user")
+	}
+
+	h := sha256.New()
+	h.Write([]byte(machine + "\n" + current.Uid))
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func machineID() (string, error) {
+	switch runtime.GOOS {
+	case "darwin":
+		out, err := exec.Command("ioreg", "-rd1", "-c", "IOPlatformExpertDevice").Output()
+		if err != nil {
+			return "", err
+		}
+		if match := darwinPlatformUUID.FindSubmatch(out); match != nil {
+			return string(match[1]), nil
+		}
+		return "", errors.New("IOPlatformUUID not found")
+
+	case "windows":
+		out, err := exec.Command("reg", "query", `HKLM\SOFTWARE\Microsoft\Cryptography`, "/v", "MachineGuid").Output()
+		if err != nil {
+			return "", err
+		}
+		if match := windowsMachineGUIDs.FindSubmatch(out); match != nil {
+			return string(match[1]), nil
+		}
+		return "", errors.New("MachineGuid not found")
+
+	default:
+		for _, p := range machineIDFiles {
+			if content, err := os.ReadFile(p); err == nil {
+				if id := strings.TrimSpace(string(content)); id != "" {
+					return id, nil
+				}
+			}
+		}
+		return "", errors.New("no machine id available")
+	}
+}
@@ -0,0 +1,48 @@
+package auth0cliauthorizer
+
+import (
+	"bytes"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestHostFingerprintFallsBackToHostname(t *testing.T) {
+	if runtime.GOOS == "darwin" || runtime.GOOS == "windows" {
+		t.Skip("the machine id is not read from files on " + runtime.GOOS)
+	}
+
+	original := machineIDFiles
+	defer func() { machineIDFiles = original }()
+	machineIDFiles = []string{t.TempDir() + "/missing"}
+	hostnameFallbackWarning = sync.Once{}
+
+	var logs bytes.Buffer
+	logger := &loggerWrapper{underlying: &consoleLogger{out: &logs}}
+	first, err := hostFingerprint(logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := hostFingerprint(logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first == "" || first != second {
+		t.Fatalf("expected a stable fingerprint, got %q and %q", first, second)
+	}
+	if warnings := strings.Count(logs.String(), "binding the sessions to the hostname"); warnings != 1 {
+		t.Fatalf("expected the fallback to be warned about once, got %d warnings", warnings)
+	}
+}
+
+func TestHostBindingRequiresFileSystemStore(t *testing.T) {
+	_, err := New("https://tenant.eu.auth0.com", "client", "https://api",
+		WithLogger(nil),
+		WithStoreURL("memory://", 0),
+		WithHostBinding(true),
+	)
+	if err != errHostBindingNotSupported {
+		t.Fatalf("expected errHostBindingNotSupported, got %v", err)
+	}
+}
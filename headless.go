@@ -0,0 +1,47 @@
+package auth0cliauthorizer
+
+import (
+	"os"
+	"runtime"
+	"strings"
+)
+
+// what detectHeadless looks at, variables so that tests can fake the session
+var (
+	getenv          = os.Getenv
+	stdinIsTerminal = func() bool { return isCharDevice(os.Stdin) }
+	procVersionPath = "/proc/version"
+)
+
+func detectHeadless() (bool, string) {
+	if getenv("SSH_CONNECTION") != "" || getenv("SSH_TTY") != "" {
+		return true, "running in an SSH session"
+	}
+
+	if !stdinIsTerminal() {
+		return true, "stdin is not a terminal"
+	}
+
+	switch runtime.GOOS {
+	case "linux", "freebsd", "openbsd", "netbsd", "dragonfly", "solaris":
+		if getenv("DISPLAY") == "" && getenv("WAYLAND_DISPLAY") == "" && !isWSL() {
+			return true, "no graphical display is available"
+		}
+	}
+
+	return false, ""
+}
+
+func isWSL() bool {
+	if runtime.GOOS != "linux" {
+		return false
+	}
+	if getenv("WSL_DISTRO_NAME") != "" || getenv("WSL_INTEROP") != "" {
+		return true
+	}
+	version, err := os.ReadFile(procVersionPath)
+	if err != nil {
+		return false
+	}
+	return strings.Contains(strings.ToLower(string(version)), "microsoft")
+}
@@ -0,0 +1,60 @@
+package auth0cliauthorizer
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+// fakeSession replaces the environment seen by detectHeadless for the duration of the test.
+func fakeSession(t *testing.T, env map[string]string, terminal bool, procVersion string) {
+	previousGetenv, previousStdinIsTerminal, previousProcVersionPath := getenv, stdinIsTerminal, procVersionPath
+	t.Cleanup(func() {
+		getenv, stdinIsTerminal, procVersionPath = previousGetenv, previousStdinIsTerminal, previousProcVersionPath
+	})
+
+	procVersionPath = filepath.Join(t.TempDir(), "version")
+	if err := os.WriteFile(procVersionPath, []byte(procVersion), 0600); err != nil {
+		t.Fatal(err)
+	}
+	getenv = func(key string) string { return env[key] }
+	stdinIsTerminal = func() bool { return terminal }
+}
+
+func TestDetectHeadless(t *testing.T) {
+	const linux = "Linux version 5.15.0-91-generic (buildd@lcy02-amd64-045)"
+	const wsl = "Linux version 5.15.133.1-microsoft-standard-WSL2"
+	display := map[string]string{"DISPLAY": ":0"}
+
+	for name, tc := range map[string]struct {
+		env         map[string]string
+		terminal    bool
+		procVersion string
+		// unixOnly cases depend on the display check, done on unix desktops only
+		unixOnly bool
+		headless bool
+		reason   string
+	}{
+		"desktop":         {env: display, terminal: true, procVersion: linux},
+		"ssh connection":  {env: map[string]string{"DISPLAY": ":0", "SSH_CONNECTION": "10.0.0.1 50000 10.0.0.2 22"}, terminal: true, procVersion: linux, headless: true, reason: "running in an SSH session"},
+		"ssh tty":         {env: map[string]string{"DISPLAY": ":0", "SSH_TTY": "/dev/pts/0"}, terminal: true, procVersion: linux, headless: true, reason: "running in an SSH session"},
+		"no tty":          {env: display, procVersion: linux, headless: true, reason: "stdin is not a terminal"},
+		"no display":      {env: map[string]string{}, terminal: true, procVersion: linux, unixOnly: true, headless: true, reason: "no graphical display is available"},
+		"wayland":         {env: map[string]string{"WAYLAND_DISPLAY": "wayland-0"}, terminal: true, procVersion: linux, unixOnly: true},
+		"wsl from env":    {env: map[string]string{"WSL_DISTRO_NAME": "Ubuntu"}, terminal: true, procVersion: linux, unixOnly: true},
+		"wsl from kernel": {env: map[string]string{}, terminal: true, procVersion: wsl, unixOnly: true},
+	} {
+		t.Run(name, func(t *testing.T) {
+			if tc.unixOnly && runtime.GOOS != "linux" {
+				t.Skip("the display is only checked on linux and the other unix desktops")
+			}
+			fakeSession(t, tc.env, tc.terminal, tc.procVersion)
+
+			headless, reason := detectHeadless()
+			if headless != tc.headless || reason != tc.reason {
+				t.Fatalf("expected %v (%q), got %v (%q)", tc.headless, tc.reason, headless, reason)
+			}
+		})
+	}
+}
@@ -0,0 +1,131 @@
+package auth0cliauthorizer
+
+import (
+	"context"
+	"net/url"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+type HousekeepingPolicy struct {
+	// ExpiredFor removes entries with no refresh token whose access token
+	// expired longer than this ago.
+	ExpiredFor time.Duration
+	// UnusedFor removes entries that were not updated for this long. Zero disables the check.
+	UnusedFor time.Duration
+	// Revoke revokes the refresh token of the removed entries, when their tenant is known.
+	Revoke bool
+}
+
+// housekeepingTimeout bounds the automatic passes, revocations included.
+const housekeepingTimeout = 30 * time.Second
+
+var DefaultHousekeepingPolicy = HousekeepingPolicy{
+	ExpiredFor: 24 * time.Hour,
+	UnusedFor:  90 * 24 * time.Hour,
+	Revoke:     true,
+}
+
+// Housekeeping removes orphaned and expired entries from the store, for every tenant,
+// and returns the removed sessions. Errors revoking the tokens do not stop the cleanup.
+func (a *DefaultImpl) Housekeeping(ctx context.Context, policy HousekeepingPolicy) ([]CachedSession, error) {
+	catalog, err := a.sessionCatalog()
+	if err != nil {
+		return nil, err
+	}
+
+	sessions, err := catalog.ListSessions()
+	if err != nil {
+		return nil, errors.Wrap(err, "error listing cached sessions")
+	}
+
+	now := time.Now()
+	var removed []CachedSession
+
+	for _, session := range sessions {
+		reason := policy.removalReason(session, now)
+		if reason == "" {
+			continue
+		}
+
+		a.logger.Debugf("removing cached session of %s for %s: %s", session.Email, session.Domain, reason)
+
+		if policy.Revoke && session.HasRefreshToken {
+			a.revokeCachedSession(ctx, catalog, session)
+		}
+
+		if err = catalog.RemoveSession(session); err != nil {
+			return removed, errors.Wrap(err, "error removing cached session")
+		}
+		removed = append(removed, session)
+	}
+
+	return removed, nil
+}
+
+func (p HousekeepingPolicy) removalReason(session CachedSession, now time.Time) string {
+	if !session.HasRefreshToken && !session.ExpiresAt.IsZero() && now.Sub(session.ExpiresAt) > p.ExpiredFor {
+		return "expired and not refreshable"
+	}
+	if p.UnusedFor > 0 && !session.UpdatedAt.IsZero() && now.Sub(session.UpdatedAt) > p.UnusedFor {
+		return "not used for a long time"
+	}
+	return ""
+}
+
+func (a *DefaultImpl) revokeCachedSession(ctx context.Context, catalog sessionCatalog, session CachedSession) {
+	if session.Domain == "" || session.ClientID == "" {
+		a.logger.Debugf("not revoking the cached session of %s: unknown tenant", session.Email)
+		return
+	}
+
+	domain, err := url.Parse(session.Domain)
+	if err != nil {
+		a.logger.Warningf("not revoking the cached session of %s: invalid domain %s", session.Email, session.Domain)
+		return
+	}
+
+	loaded, err := catalog.LoadSession(session)
+	if err != nil || loaded == nil {
+		a.logger.Warningf("not revoking the cached session of %s: %v", session.Email, err)
+		return
+	}
+
+	if err = a.revokeRefreshTokenOn(ctx, domain, session.ClientID, loaded.Tokens.RefreshToken); err != nil {
+		a.logger.Warningf("error revoking the cached session of %s for %s: %v", session.Email, session.Domain, err)
+	}
+}
+
+// opportunisticHousekeeping runs in the background, one pass at a time,
+// so that the authentication is not held up by the revocations for other tenants.
+func (a *DefaultImpl) opportunisticHousekeeping() {
+	if a.housekeepingPolicy == nil {
+		return
+	}
+	if _, ok := a.store.(sessionCatalog); !ok {
+		return
+	}
+	if !atomic.CompareAndSwapInt32(&a.housekeepingRunning, 0, 1) {
+		return
+	}
+
+	a.housekeepingDone.Add(1)
+	go func() {
+		defer a.housekeepingDone.Done()
+		defer atomic.StoreInt32(&a.housekeepingRunning, 0)
+
+		ctx, cancel := context.WithTimeout(context.Background(), housekeepingTimeout)
+		defer cancel()
+
+		removed, err := a.Housekeeping(ctx, *a.housekeepingPolicy)
+		if err != nil {
+			a.logger.Warningf("store housekeeping failed: %v", err)
+			return
+		}
+		if len(removed) > 0 {
+			a.logger.Debugf("store housekeeping removed %d cached sessions", len(removed))
+		}
+	}()
+}
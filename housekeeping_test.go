@@ -0,0 +1,130 @@
+package auth0cliauthorizer
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+)
+
+// writeTestSession stores an authentication for the given key as if it was last saved at updatedAt.
+func writeTestSession(t *testing.T, dir, key string, metadata SessionMetadata, authentication Authentication, updatedAt time.Time) {
+	payload, err := json.Marshal(authentication)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serialized, err := json.Marshal(storageEnvelope{
+		SchemaVersion:  currentSchemaVersion,
+		CreatedAt:      updatedAt,
+		UpdatedAt:      updatedAt,
+		Authentication: payload,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = os.WriteFile(filepath.Join(dir, key+sessionFileSuffix), serialized, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	serialized, err = json.Marshal(metadata)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = os.WriteFile(filepath.Join(dir, key+metadataFileSuffix), serialized, 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// writeTestSessions stores an expired, an unused and a fresh session of other tenants.
+func writeTestSessions(t *testing.T, f *fakeAuth0, dir string) {
+	now := time.Now()
+	metadata := SessionMetadata{Domain: f.srv.URL, ClientID: "other-client", Audience: "https://other-api"}
+
+	writeTestSession(t, dir, "expired", metadata, Authentication{
+		User:   User{Sub: "auth0|expired", Email: "expired@example.com"},
+		Tokens: Tokens{AccessToken: "access-expired", ExpiresAt: now.Add(-48 * time.Hour)},
+	}, now.Add(-48*time.Hour))
+	writeTestSession(t, dir, "unused", metadata, Authentication{
+		User:   User{Sub: "auth0|unused", Email: "unused@example.com"},
+		Tokens: Tokens{AccessToken: "access-unused", RefreshToken: "refresh-unused", ExpiresAt: now.Add(-100 * 24 * time.Hour)},
+	}, now.Add(-100*24*time.Hour))
+	writeTestSession(t, dir, "fresh", metadata, Authentication{
+		User:   User{Sub: "auth0|fresh", Email: "fresh@example.com"},
+		Tokens: Tokens{AccessToken: "access-fresh", RefreshToken: "refresh-fresh", ExpiresAt: now.Add(-time.Hour)},
+	}, now.Add(-time.Hour))
+}
+
+func removedEmails(removed []CachedSession) []string {
+	var emails []string
+	for _, session := range removed {
+		emails = append(emails, session.Email)
+	}
+	sort.Strings(emails)
+	return emails
+}
+
+func TestHousekeeping(t *testing.T) {
+	for name, revoke := range map[string]bool{"revoke": true, "no revoke": false} {
+		t.Run(name, func(t *testing.T) {
+			f := newFakeAuth0(t)
+			dir := t.TempDir()
+			writeTestSessions(t, f, dir)
+			a := newTestAuthorizer(t, f, "https://api", WithFileSystemStore(dir, 0))
+
+			policy := DefaultHousekeepingPolicy
+			policy.Revoke = revoke
+			removed, err := a.Housekeeping(context.Background(), policy)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if emails := removedEmails(removed); len(emails) != 2 || emails[0] != "expired@example.com" || emails[1] != "unused@example.com" {
+				t.Fatalf("expected the expired and the unused sessions to be removed, got %v", emails)
+			}
+			for _, key := range []string{"expired", "unused"} {
+				if checkFileExists(filepath.Join(dir, key+sessionFileSuffix)) || checkFileExists(filepath.Join(dir, key+metadataFileSuffix)) {
+					t.Fatalf("expected the files of the %s session to be removed", key)
+				}
+			}
+			if !checkFileExists(filepath.Join(dir, "fresh"+sessionFileSuffix)) {
+				t.Fatal("expected the fresh session to be kept")
+			}
+
+			revoked := f.revokedTokens()
+			if revoke && (len(revoked) != 1 || revoked[0] != "refresh-unused") {
+				t.Fatalf("expected the refresh token of the unused session to be revoked, got %v", revoked)
+			}
+			if !revoke && len(revoked) != 0 {
+				t.Fatalf("expected no revocation, got %v", revoked)
+			}
+			if revoke && f.revocations[0].Get("client_id") != "other-client" {
+				t.Fatalf("expected the revocation for the client of the session, got %v", f.revocations[0])
+			}
+		})
+	}
+}
+
+func TestHousekeepingAfterAuthorize(t *testing.T) {
+	f := newFakeAuth0(t)
+	dir := t.TempDir()
+	writeTestSessions(t, f, dir)
+	a := newTestAuthorizer(t, f, "https://api", WithFileSystemStore(dir, 0), WithStoreHousekeeping(DefaultHousekeepingPolicy))
+
+	if _, err := a.Authorize(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	a.housekeepingDone.Wait()
+
+	if checkFileExists(filepath.Join(dir, "unused"+sessionFileSuffix)) {
+		t.Fatal("expected the unused session to be removed")
+	}
+	if !checkFileExists(filepath.Join(dir, "fresh"+sessionFileSuffix)) {
+		t.Fatal("expected the fresh session to be kept")
+	}
+	if loaded, err := a.store.Load(); err != nil || loaded == nil {
+		t.Fatalf("expected the new authentication to be kept, got %v, %v", loaded, err)
+	}
+}
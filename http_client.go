@@ -37,7 +37,11 @@ func (a *DefaultImpl) getHTTPClient() *http.Client {
 }
 
 func (a *DefaultImpl) relativeURL(relative string) string {
-	url, err := url.Parse(a.domain.String())
+	return joinURL(a.domain, relative)
+}
+
+func joinURL(base *url.URL, relative string) string {
+	url, err := url.Parse(base.String())
 	if err != nil {
 		panic(err)
 	}
@@ -45,6 +49,15 @@ func (a *DefaultImpl) relativeURL(relative string) string {
 	return url.String()
 }
 
+func (a *DefaultImpl) browserLogoutURL() string {
+	query := url.Values{}
+	query.Set("client_id", a.clientID)
+	if a.browserLogoutReturnTo != "" {
+		query.Set("returnTo", a.browserLogoutReturnTo)
+	}
+	return a.relativeURL("v2/logout") + "?" + query.Encode()
+}
+
 func (a *DefaultImpl) onRequest(req *http.Request) {
 	a.logger.Debugf("sending HTTP %s request to %s", req.Method, req.URL.String())
 }
@@ -79,6 +92,10 @@ func (a *DefaultImpl) doWithClient(req *http.Request, target interface{}) error
 		return parseError(res, body)
 	}
 
+	if target == nil {
+		return nil
+	}
+
 	if err = json.Unmarshal(body, target); err != nil {
 		return errors.Wrap(err, "error decoding response")
 	}
@@ -87,7 +104,10 @@ func (a *DefaultImpl) doWithClient(req *http.Request, target interface{}) error
 }
 
 func parseError(res *http.Response, body []byte) error {
-	generic := errors.Errorf("error %d (%s)", res.StatusCode, res.Status)
+	generic := &httpStatusError{
+		StatusCode: res.StatusCode,
+		Status:     res.Status,
+	}
 
 	if !strings.Contains(strings.ToLower(res.Header.Get(headerContentType)), "/json") {
 		return generic
@@ -0,0 +1,130 @@
+package auth0cliauthorizer
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/pkg/errors"
+)
+
+const (
+	jweAlgorithm  = "RSA-OAEP-256"
+	jweEncryption = "A256GCM"
+	// jweContentKeySize is the key size of A256GCM
+	jweContentKeySize = 32
+)
+
+type jweHeader struct {
+	Algorithm   string `json:"alg"`
+	Encryption  string `json:"enc"`
+	Compression string `json:"zip"`
+	ContentType string `json:"cty"`
+}
+
+func parseRSAPrivateKey(pemKey []byte) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode(pemKey)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, errors.Wrap(err, "error parsing the private key")
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("not an RSA private key")
+	}
+	return key, nil
+}
+
+// isJWE tells compact JWE serializations, made of five parts, from JWTs, made of three.
+func isJWE(token string) bool {
+	return strings.Count(token, ".") == 4
+}
+
+// decryptJWE returns the payload of a compact JWE token.
+func decryptJWE(token string, key *rsa.PrivateKey) ([]byte, *jweHeader, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 5 {
+		return nil, nil, errors.New("not a compact JWE token")
+	}
+
+	decoded := make([][]byte, len(parts))
+	for i, part := range parts {
+		var err error
+		if decoded[i], err = base64.RawURLEncoding.DecodeString(part); err != nil {
+			return nil, nil, errors.Wrapf(err, "error decoding part %d of the JWE token", i+1)
+		}
+	}
+	rawHeader, encryptedKey, iv, ciphertext, tag := decoded[0], decoded[1], decoded[2], decoded[3], decoded[4]
+
+	var header jweHeader
+	if err := json.Unmarshal(rawHeader, &header); err != nil {
+		return nil, nil, errors.Wrap(err, "error deserializing the JWE header")
+	}
+	if header.Algorithm != jweAlgorithm || header.Encryption != jweEncryption {
+		return nil, nil, errors.Errorf("unsupported JWE algorithm %s with encryption %s", header.Algorithm, header.Encryption)
+	}
+	if header.Compression != "" {
+		return nil, nil, errors.Errorf("unsupported JWE compression %s", header.Compression)
+	}
+
+	contentKey, err := rsa.DecryptOAEP(sha256.New(), nil, key, encryptedKey, nil)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "error decrypting the content encryption key")
+	}
+	if len(contentKey) != jweContentKeySize {
+		return nil, nil, errors.Errorf("invalid content encryption key size %d for %s", len(contentKey), jweEncryption)
+	}
+
+	block, err := aes.NewCipher(contentKey)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "error building the cipher")
+	}
+	aead, err := cipher.NewGCMWithNonceSize(block, len(iv))
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "error building the cipher")
+	}
+
+	// the additional authenticated data is the encoded protected header
+	payload, err := aead.Open(nil, iv, append(ciphertext, tag...), []byte(parts[0]))
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "error decrypting the JWE payload")
+	}
+
+	return payload, &header, nil
+}
+
+// parseJWEClaims reads the claims of a JWE token, whose payload is either
+// a nested JWT or the claims themselves.
+func parseJWEClaims(token string, key *rsa.PrivateKey, claims jwt.Claims) error {
+	payload, header, err := decryptJWE(token, key)
+	if err != nil {
+		return err
+	}
+
+	if strings.EqualFold(header.ContentType, "JWT") || !strings.HasPrefix(strings.TrimSpace(string(payload)), "{") {
+		if _, _, err = jwt.NewParser().ParseUnverified(string(payload), claims); err != nil {
+			return errors.Wrap(err, "error decoding the nested token")
+		}
+		return nil
+	}
+
+	if err = json.Unmarshal(payload, claims); err != nil {
+		return errors.Wrap(err, "error deserializing the JWE claims")
+	}
+	return nil
+}
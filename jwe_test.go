@@ -0,0 +1,132 @@
+package auth0cliauthorizer
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"strings"
+	"testing"
+)
+
+func generateTestRSAKey(t *testing.T) *rsa.PrivateKey {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+// encryptTestJWE builds a compact JWE with RSA-OAEP-256 and AES-GCM,
+// whatever the header says, using a content encryption key of keySize bytes.
+func encryptTestJWE(t *testing.T, key *rsa.PublicKey, header jweHeader, keySize int, payload []byte) string {
+	rawHeader, err := json.Marshal(header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encodedHeader := base64.RawURLEncoding.EncodeToString(rawHeader)
+
+	contentKey := make([]byte, keySize)
+	iv := make([]byte, 12)
+	if _, err = rand.Read(contentKey); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = rand.Read(iv); err != nil {
+		t.Fatal(err)
+	}
+
+	encryptedKey, err := rsa.EncryptOAEP(sha256.New(), rand.Reader, key, contentKey, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, err := aes.NewCipher(contentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sealed := aead.Seal(nil, iv, payload, []byte(encodedHeader))
+	ciphertext, tag := sealed[:len(sealed)-aead.Overhead()], sealed[len(sealed)-aead.Overhead():]
+
+	return strings.Join([]string{
+		encodedHeader,
+		base64.RawURLEncoding.EncodeToString(encryptedKey),
+		base64.RawURLEncoding.EncodeToString(iv),
+		base64.RawURLEncoding.EncodeToString(ciphertext),
+		base64.RawURLEncoding.EncodeToString(tag),
+	}, ".")
+}
+
+func TestDecryptJWE(t *testing.T) {
+	key := generateTestRSAKey(t)
+	header := jweHeader{Algorithm: jweAlgorithm, Encryption: jweEncryption}
+
+	var claims accessTokenContentDTO
+	token := encryptTestJWE(t, &key.PublicKey, header, jweContentKeySize, []byte(`{"iss":"https://tenant.eu.auth0.com/","permissions":["read:things"]}`))
+	if err := parseJWEClaims(token, key, &claims); err != nil {
+		t.Fatal(err)
+	}
+	if claims.Issuer != "https://tenant.eu.auth0.com/" || len(claims.Permissions) != 1 || claims.Permissions[0] != "read:things" {
+		t.Fatalf("unexpected claims %+v", claims)
+	}
+}
+
+func TestDecryptJWEWithWrongKey(t *testing.T) {
+	key, other := generateTestRSAKey(t), generateTestRSAKey(t)
+
+	token := encryptTestJWE(t, &key.PublicKey, jweHeader{Algorithm: jweAlgorithm, Encryption: jweEncryption}, jweContentKeySize, []byte(`{}`))
+	if _, _, err := decryptJWE(token, other); err == nil {
+		t.Fatal("expected the decryption with another key to fail")
+	}
+}
+
+func TestDecryptJWEUnsupported(t *testing.T) {
+	key := generateTestRSAKey(t)
+
+	for name, tc := range map[string]struct {
+		header  jweHeader
+		keySize int
+	}{
+		"alg":      {jweHeader{Algorithm: "RSA1_5", Encryption: jweEncryption}, jweContentKeySize},
+		"enc":      {jweHeader{Algorithm: jweAlgorithm, Encryption: "A128CBC-HS256"}, jweContentKeySize},
+		"zip":      {jweHeader{Algorithm: jweAlgorithm, Encryption: jweEncryption, Compression: "DEF"}, jweContentKeySize},
+		"key size": {jweHeader{Algorithm: jweAlgorithm, Encryption: jweEncryption}, 16},
+	} {
+		t.Run(name, func(t *testing.T) {
+			token := encryptTestJWE(t, &key.PublicKey, tc.header, tc.keySize, []byte(`{}`))
+			if _, _, err := decryptJWE(token, key); err == nil {
+				t.Fatal("expected the token to be refused")
+			}
+		})
+	}
+}
+
+func TestAuthorizeWithAccessTokenDecryptionKey(t *testing.T) {
+	f := newFakeAuth0(t)
+	key := generateTestRSAKey(t)
+	nested := f.signedAccessToken(f.srv.URL+"/", "https://api")
+	f.accessToken = encryptTestJWE(t, &key.PublicKey, jweHeader{Algorithm: jweAlgorithm, Encryption: jweEncryption, ContentType: "JWT"},
+		jweContentKeySize, []byte(nested))
+
+	pemKey := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	a := newTestAuthorizer(t, f, "https://api", WithAccessTokenDecryptionKey(pemKey))
+
+	authentication, err := a.Authorize(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(authentication.User.Permissions) != 1 || authentication.User.Permissions[0] != "read:things" {
+		t.Fatalf("expected the permissions from the decrypted access token, got %v", authentication.User.Permissions)
+	}
+	if err = a.validateRestoredTokens(authentication.Tokens); err != nil {
+		t.Fatalf("expected the decrypted access token to be valid for the tenant, got %v", err)
+	}
+}
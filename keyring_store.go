@@ -0,0 +1,70 @@
+package auth0cliauthorizer
+
+import (
+	"encoding/json"
+
+	"github.com/pkg/errors"
+	"github.com/zalando/go-keyring"
+)
+
+const defaultKeyringService = "auth0-cli-auth"
+
+type keyringStore struct {
+	service string
+	key     string
+}
+
+var _ Store = &keyringStore{}
+
+// NewKeyringStoreFactory keeps the entries in the OS keyring (macOS Keychain, Windows Credential Manager,
+// Secret Service on Linux) under the given service name, "auth0-cli-auth" if empty.
+// Some keyrings limit the size of the entries: it is meant to be used with WithSecureStore.
+func NewKeyringStoreFactory(service string) StoreFactory {
+	if service == "" {
+		service = defaultKeyringService
+	}
+	return func(key string) (Store, error) {
+		if key == "" {
+			return nil, errors.New("missing key")
+		}
+		return &keyringStore{
+			service: service,
+			key:     key,
+		}, nil
+	}
+}
+
+func (k *keyringStore) Save(authentication Authentication) error {
+	serialized, err := json.Marshal(authentication)
+	if err != nil {
+		return errors.Wrap(err, "error serializing authentication")
+	}
+
+	if err = keyring.Set(k.service, k.key, string(serialized)); err != nil {
+		return errors.Wrap(err, "error writing to the keyring")
+	}
+	return nil
+}
+
+func (k *keyringStore) Load() (*Authentication, error) {
+	serialized, err := keyring.Get(k.service, k.key)
+	if errors.Is(err, keyring.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "error reading from the keyring")
+	}
+
+	var authentication Authentication
+	if err = json.Unmarshal([]byte(serialized), &authentication); err != nil {
+		return nil, errors.Wrap(err, "error deserializing authentication")
+	}
+	return &authentication, nil
+}
+
+func (k *keyringStore) Clear() error {
+	if err := keyring.Delete(k.service, k.key); err != nil && !errors.Is(err, keyring.ErrNotFound) {
+		return errors.Wrap(err, "error removing from the keyring")
+	}
+	return nil
+}
@@ -2,7 +2,10 @@ package auth0cliauthorizer
 
 import (
 	"fmt"
+	"io"
+	"os"
 	"strings"
+	"sync"
 )
 
 type Logger interface {
@@ -12,24 +15,35 @@ type Logger interface {
 	Error(args ...interface{})
 }
 
-type consoleLogger struct{}
+// consoleLogger writes to out, stdout if nil.
+type consoleLogger struct {
+	out io.Writer
+}
 
 var _ Logger = &consoleLogger{}
 
 func (c consoleLogger) Debug(args ...interface{}) {
-	fmt.Println("[debug] " + c.message(args))
+	c.println("[debug] " + c.message(args))
 }
 
 func (c consoleLogger) Info(args ...interface{}) {
-	fmt.Println("[info]  " + c.message(args))
+	c.println("[info]  " + c.message(args))
 }
 
 func (c consoleLogger) Warning(args ...interface{}) {
-	fmt.Println("[WARN]  " + c.message(args))
+	c.println("[WARN]  " + c.message(args))
 }
 
 func (c consoleLogger) Error(args ...interface{}) {
-	fmt.Println("[ERROR] " + c.message(args))
+	c.println("[ERROR] " + c.message(args))
+}
+
+func (c consoleLogger) println(line string) {
+	out := c.out
+	if out == nil {
+		out = os.Stdout
+	}
+	_, _ = fmt.Fprintln(out, line)
 }
 
 func (c consoleLogger) message(args ...interface{}) string {
@@ -62,36 +76,58 @@ func (c noOpLogger) Error(_ ...interface{}) {
 
 type loggerWrapper struct {
 	underlying Logger
+
+	// mu guards around, set while a terminal prompt owns the output
+	mu     sync.Mutex
+	around func(log func())
+}
+
+func (a *loggerWrapper) setAround(around func(log func())) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.around = around
+}
+
+func (a *loggerWrapper) log(log func()) {
+	a.mu.Lock()
+	around := a.around
+	a.mu.Unlock()
+
+	if around != nil {
+		around(log)
+		return
+	}
+	log()
 }
 
 func (a *loggerWrapper) Debug(args ...interface{}) {
-	a.underlying.Debug(args...)
+	a.log(func() { a.underlying.Debug(args...) })
 }
 
 func (a *loggerWrapper) Info(args ...interface{}) {
-	a.underlying.Info(args...)
+	a.log(func() { a.underlying.Info(args...) })
 }
 
 func (a *loggerWrapper) Warning(args ...interface{}) {
-	a.underlying.Warning(args...)
+	a.log(func() { a.underlying.Warning(args...) })
 }
 
 func (a *loggerWrapper) Error(args ...interface{}) {
-	a.underlying.Error(args...)
+	a.log(func() { a.underlying.Error(args...) })
 }
 
 func (a *loggerWrapper) Debugf(msg string, args ...interface{}) {
-	a.underlying.Debug(fmt.Sprintf(msg, args...))
+	a.Debug(fmt.Sprintf(msg, args...))
 }
 
 func (a *loggerWrapper) Infof(msg string, args ...interface{}) {
-	a.underlying.Info(fmt.Sprintf(msg, args...))
+	a.Info(fmt.Sprintf(msg, args...))
 }
 
 func (a *loggerWrapper) Warningf(msg string, args ...interface{}) {
-	a.underlying.Warning(fmt.Sprintf(msg, args...))
+	a.Warning(fmt.Sprintf(msg, args...))
 }
 
 func (a *loggerWrapper) Errorf(msg string, args ...interface{}) {
-	a.underlying.Error(fmt.Sprintf(msg, args...))
+	a.Error(fmt.Sprintf(msg, args...))
 }
@@ -0,0 +1,119 @@
+package auth0cliauthorizer
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func newLoggedInTestAuthorizer(t *testing.T, f *fakeAuth0, options ...Option) *DefaultImpl {
+	a := newTestAuthorizer(t, f, "https://api", append([]Option{WithFileSystemStore(t.TempDir(), 0)}, options...)...)
+	err := a.store.Save(Authentication{
+		User:   User{Sub: f.sub, Email: "alice@example.com"},
+		Tokens: Tokens{AccessToken: "access-token", RefreshToken: "refresh-token"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return a
+}
+
+func assertStoreCleared(t *testing.T, a *DefaultImpl) {
+	t.Helper()
+	if loaded, err := a.store.Load(); err != nil || loaded != nil {
+		t.Fatalf("expected the store to be cleared, got %v, %v", loaded, err)
+	}
+}
+
+func TestLogoutRevokesRefreshToken(t *testing.T) {
+	f := newFakeAuth0(t)
+	a := newLoggedInTestAuthorizer(t, f)
+
+	if err := a.Logout(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(f.revocations) != 1 {
+		t.Fatalf("expected one revocation, got %v", f.revocations)
+	}
+	if revocation := f.revocations[0]; revocation.Get("token") != "refresh-token" || revocation.Get("client_id") != "client" {
+		t.Fatalf("unexpected revocation request %v", revocation)
+	}
+	assertStoreCleared(t, a)
+}
+
+func TestLogoutRevocationFailure(t *testing.T) {
+	f := newFakeAuth0(t)
+	f.failRevoke = true
+	a := newLoggedInTestAuthorizer(t, f)
+
+	err := a.Logout(context.Background())
+	var revocationErr *RevocationError
+	if !errors.As(err, &revocationErr) {
+		t.Fatalf("expected a *RevocationError, got %v", err)
+	}
+	assertStoreCleared(t, a)
+}
+
+func TestLogoutWithoutRevocation(t *testing.T) {
+	f := newFakeAuth0(t)
+	a := newLoggedInTestAuthorizer(t, f, WithRevokeOnLogout(false))
+
+	if err := a.Logout(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(f.revocations) != 0 {
+		t.Fatalf("expected no revocation, got %v", f.revocations)
+	}
+	assertStoreCleared(t, a)
+}
+
+func TestLogoutOpensBrowserLogoutURL(t *testing.T) {
+	for name, tc := range map[string]struct {
+		returnTo string
+		expected string
+	}{
+		"without returnTo": {"", "/v2/logout?client_id=client"},
+		"with returnTo":    {"https://app.example.com/bye?x=1", "/v2/logout?client_id=client&returnTo=https%3A%2F%2Fapp.example.com%2Fbye%3Fx%3D1"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			f := newFakeAuth0(t)
+			var opened []string
+			a := newLoggedInTestAuthorizer(t, f, WithBrowserLogout(tc.returnTo),
+				WithBrowserOpener(func(_ context.Context, url string) error {
+					opened = append(opened, url)
+					return nil
+				}))
+
+			if err := a.Logout(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+			if len(opened) != 1 || opened[0] != f.srv.URL+tc.expected {
+				t.Fatalf("expected %s to be opened, got %v", f.srv.URL+tc.expected, opened)
+			}
+			assertStoreCleared(t, a)
+		})
+	}
+}
+
+func TestLogoutBrowserSessionWhenHeadless(t *testing.T) {
+	t.Setenv("SSH_CONNECTION", "10.0.0.1 50000 10.0.0.2 22")
+	t.Setenv("BROWSER", "")
+
+	f := newFakeAuth0(t)
+	var logs bytes.Buffer
+	a := newLoggedInTestAuthorizer(t, f, WithBrowserLogout(""), WithLogger(&consoleLogger{out: &logs}))
+
+	if err := a.Logout(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	assertStoreCleared(t, a)
+
+	// no browser is started, the URL is logged to end the session manually
+	if output := logs.String(); !strings.Contains(output, f.srv.URL+"/v2/logout?client_id=client") ||
+		!strings.Contains(output, "running in an SSH session") {
+		t.Fatalf("expected the logout URL to be logged, got %q", output)
+	}
+}
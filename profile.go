@@ -0,0 +1,186 @@
+package auth0cliauthorizer
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+type Profile struct {
+	Name     string
+	Domain   string
+	ClientID string
+	Audience string
+	Scopes   []string
+	Store    ProfileStore
+	// Options are applied after the ones derived from the other fields.
+	Options []Option
+}
+
+type ProfileStore struct {
+	Disabled bool
+	// URL selects the store backend, see NewStoreFactoryFromURL. It takes precedence over Dir.
+	URL string
+	// Dir is the directory of the store. With neither URL nor Dir the profile uses the store
+	// passed in the shared options, the app data one if none.
+	Dir         string
+	MinDuration time.Duration
+}
+
+type ProfileStatus struct {
+	Profile         string
+	LoggedIn        bool
+	User            User
+	ExpiresAt       time.Time
+	HasRefreshToken bool
+	Err             error
+}
+
+// Manager holds an Authorizer for each of several profiles,
+// e.g. one per environment (dev, staging, prod).
+type Manager struct {
+	profiles       []Profile
+	authorizers    map[string]*DefaultImpl
+	defaultProfile string
+}
+
+// NewManager builds an Authorizer for every profile. The given options are shared
+// by all the profiles and applied before the profile-specific ones.
+func NewManager(profiles []Profile, options ...Option) (*Manager, error) {
+	m := &Manager{
+		authorizers: make(map[string]*DefaultImpl, len(profiles)),
+	}
+
+	for _, profile := range profiles {
+		if profile.Name == "" {
+			return nil, errors.New("missing profile name")
+		}
+		if _, exists := m.authorizers[profile.Name]; exists {
+			return nil, errors.Errorf("duplicate profile %s", profile.Name)
+		}
+
+		authorizer, err := New(profile.Domain, profile.ClientID, profile.Audience, profile.options(options)...)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error building the authorizer for profile %s", profile.Name)
+		}
+		if authorizer == nil {
+			return nil, errors.Errorf("no authorizer built for profile %s", profile.Name)
+		}
+
+		m.profiles = append(m.profiles, profile)
+		m.authorizers[profile.Name] = authorizer
+	}
+
+	return m, nil
+}
+
+// options puts the app data store first, so that a store passed in the shared options
+// applies to the profiles that don't configure their own.
+func (p Profile) options(shared []Option) []Option {
+	options := append([]Option{WithAppDataStore(0)}, shared...)
+
+	if len(p.Scopes) > 0 {
+		options = append(options, WithScopes(p.Scopes...))
+	}
+	switch {
+	case p.Store.Disabled:
+		options = append(options, &optionNoStore{})
+	case p.Store.URL != "":
+		options = append(options, WithStoreURL(p.Store.URL, p.Store.MinDuration))
+	case p.Store.Dir != "":
+		options = append(options, WithFileSystemStore(p.Store.Dir, p.Store.MinDuration))
+	case p.Store.MinDuration != 0:
+		options = append(options, &optionStoreMinDuration{p.Store.MinDuration})
+	}
+
+	return append(options, p.Options...)
+}
+
+type optionNoStore struct{}
+
+func (o *optionNoStore) apply(target *DefaultImpl) error {
+	target.storeBuilder = nil
+	return nil
+}
+
+// optionStoreMinDuration keeps the store chosen by the other options.
+type optionStoreMinDuration struct {
+	value time.Duration
+}
+
+func (o *optionStoreMinDuration) apply(target *DefaultImpl) error {
+	target.storeRestoreMinDuration = o.value
+	return nil
+}
+
+func (m *Manager) Authorizer(name string) (*DefaultImpl, error) {
+	authorizer, ok := m.authorizers[name]
+	if !ok {
+		return nil, errors.Errorf("unknown profile %s", name)
+	}
+	return authorizer, nil
+}
+
+// Default returns the authorizer of the default profile: the one selected in the
+// configuration if any, otherwise the first profile.
+func (m *Manager) Default() (*DefaultImpl, error) {
+	if m.defaultProfile != "" {
+		return m.Authorizer(m.defaultProfile)
+	}
+	if len(m.profiles) == 0 {
+		return nil, errors.New("no profiles available")
+	}
+	return m.Authorizer(m.profiles[0].Name)
+}
+
+func (m *Manager) List() []Profile {
+	return append([]Profile{}, m.profiles...)
+}
+
+// Status reports the cached authentication of every profile, without any network access.
+// A cached session of another tenant is removed and reported in Err.
+func (m *Manager) Status() []ProfileStatus {
+	result := make([]ProfileStatus, 0, len(m.profiles))
+
+	for _, profile := range m.profiles {
+		status := ProfileStatus{
+			Profile: profile.Name,
+		}
+
+		authorizer := m.authorizers[profile.Name]
+		if authorizer.store != nil {
+			cached, err := authorizer.loadValidatedFromStore()
+			if err != nil {
+				status.Err = err
+			} else if cached != nil {
+				status.User = cached.User
+				status.ExpiresAt = cached.Tokens.ExpiresAt
+				status.HasRefreshToken = cached.Tokens.RefreshToken != ""
+				status.LoggedIn = status.HasRefreshToken || time.Now().Before(status.ExpiresAt)
+			}
+		}
+
+		result = append(result, status)
+	}
+
+	return result
+}
+
+// LogoutAll logs out every account of every profile, going on even if some of them fail.
+func (m *Manager) LogoutAll(ctx context.Context) error {
+	var failures []string
+
+	for _, profile := range m.profiles {
+		if err := m.authorizers[profile.Name].LogoutAllAccounts(ctx); err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v", profile.Name, err))
+		}
+	}
+
+	if len(failures) > 0 {
+		return errors.Errorf("error logging out from %d profiles: %s", len(failures), strings.Join(failures, "; "))
+	}
+	return nil
+}
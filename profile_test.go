@@ -0,0 +1,118 @@
+package auth0cliauthorizer
+
+import (
+	"testing"
+	"time"
+)
+
+func TestProfileUsesSharedStore(t *testing.T) {
+	t.Setenv(EnvStoreDir, t.TempDir())
+	dir := t.TempDir()
+
+	manager, err := NewManager([]Profile{
+		{Name: "shared", Domain: "https://dev.eu.auth0.com", ClientID: "client", Audience: "https://api"},
+		{Name: "min-duration", Domain: "https://staging.eu.auth0.com", ClientID: "client", Audience: "https://api",
+			Store: ProfileStore{MinDuration: 5 * time.Minute}},
+		{Name: "disabled", Domain: "https://prod.eu.auth0.com", ClientID: "client", Audience: "https://api",
+			Store: ProfileStore{Disabled: true}},
+	}, WithLogger(nil), WithFileSystemStore(dir, time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, expected := range map[string]time.Duration{"shared": time.Hour, "min-duration": 5 * time.Minute} {
+		authorizer, err := manager.Authorizer(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		store, ok := authorizer.store.(*fileSystemStore)
+		if !ok || store.dir() != dir {
+			t.Fatalf("%s: expected the shared file system store in %s, got %#v", name, dir, authorizer.store)
+		}
+		if authorizer.storeRestoreMinDuration != expected {
+			t.Fatalf("%s: expected min duration %s, got %s", name, expected, authorizer.storeRestoreMinDuration)
+		}
+	}
+
+	disabled, err := manager.Authorizer("disabled")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if disabled.store != nil {
+		t.Fatalf("expected no store for the disabled profile, got %#v", disabled.store)
+	}
+}
+
+func TestProfileDefaultsToAppDataStore(t *testing.T) {
+	t.Setenv(EnvStoreDir, t.TempDir())
+
+	manager, err := NewManager([]Profile{
+		{Name: "dev", Domain: "https://dev.eu.auth0.com", ClientID: "client", Audience: "https://api"},
+	}, WithLogger(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	authorizer, err := manager.Default()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := authorizer.store.(*appDataStore); !ok {
+		t.Fatalf("expected the app data store, got %#v", authorizer.store)
+	}
+}
+
+func TestProfileDomainWithoutScheme(t *testing.T) {
+	t.Setenv(EnvStoreDir, t.TempDir())
+
+	manager, err := NewManager([]Profile{
+		{Name: "dev", Domain: "dev.eu.auth0.com", ClientID: "client", Audience: "https://api"},
+	}, WithLogger(nil))
+	if err == nil || manager != nil {
+		t.Fatalf("expected a domain without scheme to be refused, got %v, %v", manager, err)
+	}
+}
+
+func TestManagerStatusRejectsOtherTenant(t *testing.T) {
+	f := newFakeAuth0(t)
+	manager, err := NewManager([]Profile{
+		{Name: "dev", Domain: f.srv.URL, ClientID: "client", Audience: "https://api", Store: ProfileStore{Dir: t.TempDir()}},
+	}, WithLogger(nil), WithAutoOpenBrowser(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err := manager.Authorizer("dev")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, tc := range map[string]struct {
+		issuer   string
+		loggedIn bool
+	}{
+		"same tenant":    {f.srv.URL + "/", true},
+		"another tenant": {"https://other.eu.auth0.com/", false},
+	} {
+		t.Run(name, func(t *testing.T) {
+			err := a.store.Save(Authentication{
+				User: User{Sub: f.sub, Email: "alice@example.com"},
+				Tokens: Tokens{
+					AccessToken:  f.signedAccessToken(tc.issuer, "https://api"),
+					RefreshToken: "refresh-token",
+					ExpiresAt:    time.Now().Add(time.Hour),
+				},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			status := manager.Status()
+			if len(status) != 1 || status[0].LoggedIn != tc.loggedIn || (status[0].Err == nil) != tc.loggedIn {
+				t.Fatalf("expected logged in: %v, got %+v", tc.loggedIn, status)
+			}
+			if loaded, err := a.store.Load(); err != nil || (loaded != nil) != tc.loggedIn {
+				t.Fatalf("expected the session of another tenant to be removed, got %v, %v", loaded, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,95 @@
+package auth0cliauthorizer
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+type ProgressEventType string
+
+const (
+	ProgressEventDeviceCodeIssued ProgressEventType = "device_code_issued"
+	ProgressEventBrowserOpened    ProgressEventType = "browser_opened"
+	ProgressEventBrowserFailed    ProgressEventType = "browser_failed"
+	ProgressEventPollPending      ProgressEventType = "poll_pending"
+	ProgressEventSlowDown         ProgressEventType = "slow_down"
+	ProgressEventSuccess          ProgressEventType = "success"
+	ProgressEventFailure          ProgressEventType = "failure"
+)
+
+const (
+	progressErrorCodeCanceled = "canceled"
+	progressErrorCodeTimeout  = "timeout"
+	progressErrorCodeGeneric  = "error"
+)
+
+type ProgressEvent struct {
+	Type                    ProgressEventType `json:"event"`
+	Time                    time.Time         `json:"time"`
+	UserCode                string            `json:"user_code,omitempty"`
+	VerificationUri         string            `json:"verification_uri,omitempty"`
+	VerificationUriComplete string            `json:"verification_uri_complete,omitempty"`
+	ExpiresIn               int               `json:"expires_in,omitempty"`
+	ExpiresAt               *time.Time        `json:"expires_at,omitempty"`
+	Interval                int               `json:"interval,omitempty"`
+	Email                   string            `json:"email,omitempty"`
+	ErrorCode               string            `json:"error_code,omitempty"`
+	Error                   string            `json:"error,omitempty"`
+}
+
+type jsonProgressWriter struct {
+	out io.Writer
+	mu  sync.Mutex
+}
+
+func (w *jsonProgressWriter) write(event ProgressEvent) error {
+	serialized, err := json.Marshal(event)
+	if err != nil {
+		return errors.Wrap(err, "error serializing progress event")
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	_, err = w.out.Write(append(serialized, '\n'))
+	return err
+}
+
+func (a *DefaultImpl) emitProgress(event ProgressEvent) {
+	if a.progressWriter == nil {
+		return
+	}
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	if err := a.progressWriter.write(event); err != nil {
+		a.logger.Warningf("error writing progress event: %v", err)
+	}
+}
+
+func failureProgressEvent(err error) ProgressEvent {
+	return ProgressEvent{
+		Type:      ProgressEventFailure,
+		ErrorCode: progressErrorCode(err),
+		Error:     err.Error(),
+	}
+}
+
+func progressErrorCode(err error) string {
+	var managed *managedHTTPError
+	switch {
+	case errors.As(err, &managed):
+		return managed.ErrorCode
+	case errors.Is(err, context.Canceled):
+		return progressErrorCodeCanceled
+	case errors.Is(err, context.DeadlineExceeded):
+		return progressErrorCodeTimeout
+	default:
+		return progressErrorCodeGeneric
+	}
+}
@@ -0,0 +1,106 @@
+package auth0cliauthorizer
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func readProgressEvents(t *testing.T, out *bytes.Buffer) []ProgressEvent {
+	var events []ProgressEvent
+	scanner := bufio.NewScanner(out)
+	for scanner.Scan() {
+		var event ProgressEvent
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			t.Fatalf("invalid progress line %q: %v", scanner.Text(), err)
+		}
+		events = append(events, event)
+	}
+	return events
+}
+
+func progressEventTypes(events []ProgressEvent) []ProgressEventType {
+	types := make([]ProgressEventType, 0, len(events))
+	for _, event := range events {
+		types = append(types, event.Type)
+	}
+	return types
+}
+
+func TestJSONProgressSuccess(t *testing.T) {
+	f := newFakeAuth0(t)
+	f.pending = 1
+	out := &bytes.Buffer{}
+	a := newTestAuthorizer(t, f, "https://api", WithJSONProgress(out))
+
+	if _, err := a.Authorize(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	events := readProgressEvents(t, out)
+	expected := []ProgressEventType{ProgressEventDeviceCodeIssued, ProgressEventPollPending, ProgressEventSuccess}
+	if types := progressEventTypes(events); !reflect.DeepEqual(types, expected) {
+		t.Fatalf("expected events %v, got %v", expected, types)
+	}
+	if events[0].UserCode != "ABCD-EFGH" || events[0].ExpiresAt == nil {
+		t.Fatalf("unexpected device code event %+v", events[0])
+	}
+	if events[2].Email != "alice@example.com" {
+		t.Fatalf("unexpected success event %+v", events[2])
+	}
+}
+
+func TestJSONProgressFailureCodes(t *testing.T) {
+	for _, errorCode := range []string{"access_denied", "expired_token", "unexpected_error"} {
+		t.Run(errorCode, func(t *testing.T) {
+			f := newFakeAuth0(t)
+			f.script = []fakeResponse{{http.StatusForbidden, errorCode}}
+			out := &bytes.Buffer{}
+			a := newTestAuthorizer(t, f, "https://api", WithJSONProgress(out))
+
+			if _, err := a.Authorize(context.Background()); err == nil {
+				t.Fatal("expected the authorization to fail")
+			}
+
+			events := readProgressEvents(t, out)
+			last := events[len(events)-1]
+			if last.Type != ProgressEventFailure || last.ErrorCode != errorCode {
+				t.Fatalf("expected a failure event with code %s, got %+v", errorCode, last)
+			}
+		})
+	}
+}
+
+func TestJSONProgressTimeout(t *testing.T) {
+	f := newFakeAuth0(t)
+	f.pending = 1000
+	out := &bytes.Buffer{}
+	a := newTestAuthorizer(t, f, "https://api", WithJSONProgress(out))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 1200*time.Millisecond)
+	defer cancel()
+	if _, err := a.Authorize(ctx); err == nil {
+		t.Fatal("expected the authorization to fail")
+	}
+
+	events := readProgressEvents(t, out)
+	if last := events[len(events)-1]; last.Type != ProgressEventFailure || last.ErrorCode != progressErrorCodeTimeout {
+		t.Fatalf("expected a timeout failure event, got %+v", last)
+	}
+}
+
+func TestJSONProgressToStdoutMovesLogsToStderr(t *testing.T) {
+	a, err := New("https://tenant.eu.auth0.com", "client", "https://api", WithJSONProgress(os.Stdout))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if console, ok := a.logger.underlying.(*consoleLogger); !ok || console.out != os.Stderr {
+		t.Fatalf("expected the default logger to write to stderr, got %#v", a.logger.underlying)
+	}
+}
@@ -0,0 +1,175 @@
+package auth0cliauthorizer
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+var promptSpinnerFrames = []string{"⠋", "⠙", "⠹", "⠸", "⠼", "⠴", "⠦", "⠧", "⠇", "⠏"}
+
+const promptRefreshInterval = 100 * time.Millisecond
+
+type terminalPrompt struct {
+	out         io.Writer
+	interactive bool
+	qrCode      bool
+	qrCodeStyle QRCodeStyle
+}
+
+// NewTerminalPrompt prints the verification URI and the user code to w (os.Stderr if nil),
+// with a live countdown while waiting for confirmation. Falls back to plain lines if w is not a terminal.
+func NewTerminalPrompt(w io.Writer) DeviceConfirmPromptCallback {
+	if w == nil {
+		w = os.Stderr
+	}
+	p := &terminalPrompt{
+		out:         w,
+		interactive: isTerminal(w),
+	}
+	return p.prompt
+}
+
+func (p *terminalPrompt) prompt(prompt DeviceConfirmPrompt) error {
+	lines := p.instructions(prompt)
+	for _, line := range lines {
+		if _, err := fmt.Fprintln(p.out, line); err != nil {
+			return err
+		}
+	}
+
+	if prompt.Done() == nil {
+		return nil
+	}
+
+	if p.interactive {
+		status := &promptStatus{out: p.out, linesAbove: len(lines)}
+		release := prompt.outcome.takeOverLogs(status.around)
+		prompt.outcome.watch(func() {
+			defer release()
+			p.animate(prompt, status)
+		})
+	} else {
+		prompt.outcome.watch(func() {
+			p.waitPlain(prompt)
+		})
+	}
+	return nil
+}
+
+func (p *terminalPrompt) instructions(prompt DeviceConfirmPrompt) []string {
+	lines := []string{""}
+
+	if prompt.VerificationUri != "" && prompt.UserCode != "" {
+		lines = append(lines,
+			"To authorize this device, open the following URL in your browser:",
+			"",
+			"    "+prompt.VerificationUri,
+			"",
+			"and enter the code: "+prompt.UserCode,
+		)
+		if prompt.VerificationUriComplete != "" {
+			lines = append(lines,
+				"",
+				"You can also open this URL to have the code filled in automatically:",
+				"",
+				"    "+prompt.VerificationUriComplete,
+			)
+		}
+	} else {
+		lines = append(lines,
+			"To authorize this device, open the following URL in your browser:",
+			"",
+			"    "+prompt.VerificationUriComplete,
+		)
+	}
+
+	if p.qrCode && prompt.VerificationUriComplete != "" {
+		qrLines, err := renderQRCode(prompt.VerificationUriComplete, p.qrCodeStyle)
+		if err == nil {
+			lines = append(lines, "", "or scan this QR code with your phone:", "")
+			lines = append(lines, qrLines...)
+		}
+	}
+
+	return append(lines, "")
+}
+
+func (p *terminalPrompt) animate(prompt DeviceConfirmPrompt, status *promptStatus) {
+	ticker := time.NewTicker(promptRefreshInterval)
+	defer ticker.Stop()
+
+	frame := 0
+	for {
+		select {
+		case <-prompt.Done():
+			status.finish(prompt.Err() == nil)
+			return
+		case <-ticker.C:
+			remaining := time.Until(prompt.ExpiresAt)
+			line := "waiting for confirmation, the code expires in " + formatRemaining(remaining)
+			if prompt.ExpiresAt.IsZero() {
+				line = "waiting for confirmation"
+			} else if remaining <= 0 {
+				line = "the code has expired"
+			}
+			status.draw(promptSpinnerFrames[frame%len(promptSpinnerFrames)] + " " + line)
+			frame++
+		}
+	}
+}
+
+// promptStatus is the line redrawn in place below the instructions.
+// The log output goes through it while the prompt is showing, so that the two don't mix.
+type promptStatus struct {
+	mu   sync.Mutex
+	out  io.Writer
+	line string
+	// linesAbove counts the instruction lines right above the status line,
+	// zero once some log output got in between
+	linesAbove int
+}
+
+func (s *promptStatus) draw(line string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.line = line
+	_, _ = fmt.Fprint(s.out, ansiClearLine+line)
+}
+
+func (s *promptStatus) around(log func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, _ = fmt.Fprint(s.out, ansiClearLine)
+	log()
+	s.linesAbove = 0
+	_, _ = fmt.Fprint(s.out, s.line)
+}
+
+// finish removes the status line, and the instructions too after a successful authorization.
+func (s *promptStatus) finish(success bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if success && s.linesAbove > 0 {
+		_, _ = fmt.Fprint(s.out, ansiClearLine+ansiCursorUp(s.linesAbove)+ansiClearScreen)
+	} else {
+		_, _ = fmt.Fprint(s.out, ansiClearLine)
+	}
+}
+
+func (p *terminalPrompt) waitPlain(prompt DeviceConfirmPrompt) {
+	if !prompt.ExpiresAt.IsZero() {
+		_, _ = fmt.Fprintf(p.out, "waiting for confirmation, the code expires at %s\n",
+			prompt.ExpiresAt.Format(time.Kitchen))
+	}
+
+	<-prompt.Done()
+
+	if err := prompt.Err(); err != nil {
+		_, _ = fmt.Fprintf(p.out, "authorization failed: %v\n", err)
+	} else {
+		_, _ = fmt.Fprintln(p.out, "authorization confirmed")
+	}
+}
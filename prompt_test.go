@@ -0,0 +1,77 @@
+package auth0cliauthorizer
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// syncBuffer stands in for the terminal, shared by the prompt and the logger.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+type bufferLogger struct {
+	noOpLogger
+	out *syncBuffer
+}
+
+func (l bufferLogger) Debug(args ...interface{}) {
+	_, _ = fmt.Fprintln(l.out, append([]interface{}{"[debug]"}, args...)...)
+}
+
+func TestTerminalPromptOwnsTheOutput(t *testing.T) {
+	out := &syncBuffer{}
+	logger := &loggerWrapper{underlying: bufferLogger{out: out}}
+	p := &terminalPrompt{out: out, interactive: true}
+
+	prompt := DeviceConfirmPrompt{
+		UserCode:                "ABCD-EFGH",
+		VerificationUri:         "https://tenant.eu.auth0.com/activate",
+		VerificationUriComplete: "https://tenant.eu.auth0.com/activate?user_code=ABCD-EFGH",
+		ExpiresAt:               time.Now().Add(time.Minute),
+		outcome:                 newPromptOutcome(logger),
+	}
+	if err := p.prompt(prompt); err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(3 * promptRefreshInterval)
+	logger.Debug("still waiting")
+	time.Sleep(3 * promptRefreshInterval)
+	prompt.outcome.complete(nil)
+
+	written := out.String()
+	if !strings.Contains(written, ansiClearLine+"[debug] still waiting\n") {
+		t.Fatalf("expected the status line to be cleared before the log line, got %q", written)
+	}
+	if strings.Contains(written, ansiClearScreen) {
+		t.Fatalf("expected the instructions to be left in place after some log output, got %q", written)
+	}
+
+	time.Sleep(3 * promptRefreshInterval)
+	if out.String() != written {
+		t.Fatal("expected no output from the prompt after the flow completed")
+	}
+
+	logger.Debug("done")
+	if !strings.HasSuffix(out.String(), written+"[debug] done\n") {
+		t.Fatalf("expected the log output to be released, got %q", out.String())
+	}
+}
@@ -0,0 +1,107 @@
+package auth0cliauthorizer
+
+import (
+	"io"
+	"os"
+	"runtime"
+	"strings"
+
+	"github.com/pkg/errors"
+	"rsc.io/qr"
+)
+
+type QRCodeStyle int
+
+const (
+	// QRCodeAuto uses half-blocks on UTF-8 capable terminals and ASCII otherwise.
+	QRCodeAuto QRCodeStyle = iota
+	// QRCodeHalfBlocks draws black on white with ANSI colors, so it scans on any terminal theme.
+	QRCodeHalfBlocks
+	// QRCodeASCII draws the dark modules only, so it needs a light background.
+	QRCodeASCII
+)
+
+// qrCodeQuietZone is the margin required around the code by the specification.
+const qrCodeQuietZone = 4
+
+// NewQRCodePrompt works like NewTerminalPrompt and also draws VerificationUriComplete
+// as a QR code, so that it can be scanned with a phone.
+func NewQRCodePrompt(w io.Writer, style QRCodeStyle) DeviceConfirmPromptCallback {
+	if w == nil {
+		w = os.Stderr
+	}
+	if style == QRCodeAuto {
+		style = QRCodeASCII
+		if isTerminal(w) && isUTF8Locale() {
+			style = QRCodeHalfBlocks
+		}
+	}
+	p := &terminalPrompt{
+		out:         w,
+		interactive: isTerminal(w),
+		qrCode:      true,
+		qrCodeStyle: style,
+	}
+	return p.prompt
+}
+
+func renderQRCode(content string, style QRCodeStyle) ([]string, error) {
+	code, err := qr.Encode(content, qr.L)
+	if err != nil {
+		return nil, errors.Wrap(err, "error encoding QR code")
+	}
+
+	// the quiet zone is outside of the code, where Black reports false
+	dark := code.Black
+
+	from := -qrCodeQuietZone
+	to := code.Size + qrCodeQuietZone
+
+	var lines []string
+	if style == QRCodeHalfBlocks {
+		for y := from; y < to; y += 2 {
+			var sb strings.Builder
+			sb.WriteString(ansiBlackOnWhite)
+			for x := from; x < to; x++ {
+				top := dark(x, y)
+				bottom := y+1 < to && dark(x, y+1)
+				switch {
+				case top && bottom:
+					sb.WriteString("█")
+				case top:
+					sb.WriteString("▀")
+				case bottom:
+					sb.WriteString("▄")
+				default:
+					sb.WriteString(" ")
+				}
+			}
+			sb.WriteString(ansiReset)
+			lines = append(lines, sb.String())
+		}
+		return lines, nil
+	}
+
+	for y := from; y < to; y++ {
+		var sb strings.Builder
+		for x := from; x < to; x++ {
+			if dark(x, y) {
+				sb.WriteString("##")
+			} else {
+				sb.WriteString("  ")
+			}
+		}
+		lines = append(lines, sb.String())
+	}
+	return lines, nil
+}
+
+func isUTF8Locale() bool {
+	for _, name := range []string{"LC_ALL", "LC_CTYPE", "LANG"} {
+		if value := os.Getenv(name); value != "" {
+			value = strings.ToLower(value)
+			return strings.Contains(value, "utf-8") || strings.Contains(value, "utf8")
+		}
+	}
+	return runtime.GOOS == "windows" || runtime.GOOS == "darwin"
+}
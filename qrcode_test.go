@@ -0,0 +1,71 @@
+package auth0cliauthorizer
+
+import (
+	"strings"
+	"testing"
+
+	"rsc.io/qr"
+)
+
+// parseRenderedQRCode turns the rendered lines back into a matrix of dark modules.
+func parseRenderedQRCode(t *testing.T, lines []string, style QRCodeStyle) [][]bool {
+	var matrix [][]bool
+	for _, line := range lines {
+		if style == QRCodeASCII {
+			var row []bool
+			for i := 0; i+1 < len(line); i += 2 {
+				row = append(row, line[i:i+2] == "##")
+			}
+			matrix = append(matrix, row)
+			continue
+		}
+
+		if !strings.HasPrefix(line, ansiBlackOnWhite) || !strings.HasSuffix(line, ansiReset) {
+			t.Fatalf("expected the line to be drawn black on white, got %q", line)
+		}
+		var top, bottom []bool
+		for _, r := range strings.TrimSuffix(strings.TrimPrefix(line, ansiBlackOnWhite), ansiReset) {
+			top = append(top, r == '█' || r == '▀')
+			bottom = append(bottom, r == '█' || r == '▄')
+		}
+		matrix = append(matrix, top, bottom)
+	}
+	return matrix
+}
+
+func TestRenderQRCode(t *testing.T) {
+	const content = "https://tenant.eu.auth0.com/activate?user_code=ABCD-EFGH"
+	code, err := qr.Encode(content, qr.L)
+	if err != nil {
+		t.Fatal(err)
+	}
+	size := code.Size + 2*qrCodeQuietZone
+
+	for name, style := range map[string]QRCodeStyle{"ascii": QRCodeASCII, "half blocks": QRCodeHalfBlocks} {
+		t.Run(name, func(t *testing.T) {
+			lines, err := renderQRCode(content, style)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			matrix := parseRenderedQRCode(t, lines, style)
+			// half blocks draw two rows per line, the last one is padding when size is odd
+			if len(matrix) < size || len(matrix) > size+1 {
+				t.Fatalf("expected %d rows, got %d", size, len(matrix))
+			}
+
+			for y := 0; y < size; y++ {
+				if len(matrix[y]) != size {
+					t.Fatalf("expected %d columns in row %d, got %d", size, y, len(matrix[y]))
+				}
+				for x := 0; x < size; x++ {
+					// the quiet zone is light, as reported by Black outside of the code
+					expected := code.Black(x-qrCodeQuietZone, y-qrCodeQuietZone)
+					if matrix[y][x] != expected {
+						t.Fatalf("module (%d, %d): expected dark=%v, got dark=%v", x, y, expected, matrix[y][x])
+					}
+				}
+			}
+		})
+	}
+}
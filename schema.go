@@ -0,0 +1,165 @@
+package auth0cliauthorizer
+
+import (
+	"encoding/json"
+	"os"
+	"runtime/debug"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// legacySchemaVersion identifies files written before the envelope was introduced,
+	// holding the bare Authentication.
+	legacySchemaVersion  = 0
+	currentSchemaVersion = 1
+
+	modulePath = "github.com/fabiofenoglio/auth0-cli-authorizer"
+)
+
+var errUnsupportedSchemaVersion = errors.New("unsupported storage schema version")
+
+type storageEnvelope struct {
+	SchemaVersion  int       `json:"schema_version"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+	LibraryVersion string    `json:"library_version"`
+	// HostFingerprint is set when the entry is bound to the machine and the OS user that wrote it.
+	HostFingerprint string          `json:"host_fingerprint,omitempty"`
+	Authentication  json.RawMessage `json:"authentication"`
+}
+
+// storageMigration upgrades the authentication payload by one schema version.
+type storageMigration func(payload map[string]interface{}) (map[string]interface{}, error)
+
+// storageMigrations[v] upgrades a payload from version v to v+1.
+var storageMigrations = map[int]storageMigration{
+	legacySchemaVersion: func(payload map[string]interface{}) (map[string]interface{}, error) {
+		// the bare Authentication becomes the envelope payload as it is
+		return payload, nil
+	},
+}
+
+func decodeStoredAuthentication(serialized []byte) (*Authentication, *storageEnvelope, error) {
+	var probe map[string]json.RawMessage
+	if err := json.Unmarshal(serialized, &probe); err != nil {
+		return nil, nil, errors.Wrap(err, "error deserializing stored authentication")
+	}
+
+	envelope := &storageEnvelope{}
+	if _, enveloped := probe["schema_version"]; enveloped {
+		if err := json.Unmarshal(serialized, envelope); err != nil {
+			return nil, nil, errors.Wrap(err, "error deserializing storage envelope")
+		}
+	} else {
+		envelope.SchemaVersion = legacySchemaVersion
+		envelope.Authentication = serialized
+	}
+
+	if envelope.SchemaVersion > currentSchemaVersion || envelope.SchemaVersion < legacySchemaVersion {
+		return nil, envelope, errors.Wrapf(errUnsupportedSchemaVersion, "version %d", envelope.SchemaVersion)
+	}
+
+	var payload map[string]interface{}
+	if err := json.Unmarshal(envelope.Authentication, &payload); err != nil {
+		return nil, envelope, errors.Wrap(err, "error deserializing authentication")
+	}
+
+	for version := envelope.SchemaVersion; version < currentSchemaVersion; version++ {
+		migration, ok := storageMigrations[version]
+		if !ok {
+			return nil, envelope, errors.Errorf("no migration available from storage schema version %d", version)
+		}
+
+		var err error
+		if payload, err = migration(payload); err != nil {
+			return nil, envelope, errors.Wrapf(err, "error migrating from storage schema version %d", version)
+		}
+	}
+
+	migrated, err := json.Marshal(payload)
+	if err != nil {
+		return nil, envelope, errors.Wrap(err, "error serializing migrated authentication")
+	}
+
+	var authentication Authentication
+	if err = json.Unmarshal(migrated, &authentication); err != nil {
+		return nil, envelope, errors.Wrap(err, "error deserializing authentication")
+	}
+
+	return &authentication, envelope, nil
+}
+
+func encodeStoredAuthentication(authentication Authentication, createdAt time.Time, fingerprint string) ([]byte, error) {
+	payload, err := json.Marshal(authentication)
+	if err != nil {
+		return nil, errors.Wrap(err, "error serializing authentication")
+	}
+
+	now := time.Now()
+	if createdAt.IsZero() {
+		createdAt = now
+	}
+
+	return json.MarshalIndent(storageEnvelope{
+		SchemaVersion:   currentSchemaVersion,
+		CreatedAt:       createdAt,
+		UpdatedAt:       now,
+		LibraryVersion:  libraryVersion(),
+		HostFingerprint: fingerprint,
+		Authentication:  payload,
+	}, "", "  ")
+}
+
+func readStoredAuthenticationFile(p string) (*Authentication, *storageEnvelope, error) {
+	serialized, err := os.ReadFile(p)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "error reading from file")
+	}
+	return decodeStoredAuthentication(serialized)
+}
+
+func readAuthenticationFile(p string) (*Authentication, error) {
+	authentication, _, err := readStoredAuthenticationFile(p)
+	return authentication, err
+}
+
+// writeAuthenticationFile keeps the creation date of the entry being overwritten, if any.
+func writeAuthenticationFile(p string, authentication Authentication, fingerprint string) error {
+	var createdAt time.Time
+	if serialized, err := os.ReadFile(p); err == nil {
+		if _, envelope, err := decodeStoredAuthentication(serialized); err == nil && envelope.SchemaVersion > legacySchemaVersion {
+			createdAt = envelope.CreatedAt
+		}
+	}
+
+	serialized, err := encodeStoredAuthentication(authentication, createdAt, fingerprint)
+	if err != nil {
+		return err
+	}
+
+	if err = writeFileAtomic(p, serialized, 0600); err != nil {
+		return errors.Wrap(err, "error writing to file")
+	}
+	return nil
+}
+
+func libraryVersion() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "unknown"
+	}
+	if info.Main.Path == modulePath {
+		return info.Main.Version
+	}
+	for _, dep := range info.Deps {
+		if dep.Path == modulePath {
+			if dep.Replace != nil {
+				return dep.Replace.Version
+			}
+			return dep.Version
+		}
+	}
+	return "unknown"
+}
@@ -0,0 +1,174 @@
+package auth0cliauthorizer
+
+import (
+	"encoding/json"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	metadataFileSuffix    = ".meta.json"
+	pendingFlowFileSuffix = ".pending.json"
+	sessionFileSuffix     = ".json"
+)
+
+// SessionMetadata describes the tenant a cached session belongs to.
+type SessionMetadata struct {
+	Domain   string   `json:"domain"`
+	ClientID string   `json:"client_id"`
+	Audience string   `json:"audience"`
+	Scopes   []string `json:"scopes"`
+}
+
+type CachedSession struct {
+	Key string `json:"key"`
+	SessionMetadata
+	Email           string    `json:"email"`
+	Sub             string    `json:"sub"`
+	Active          bool      `json:"active"`
+	ExpiresAt       time.Time `json:"expires_at"`
+	HasRefreshToken bool      `json:"has_refresh_token"`
+	UpdatedAt       time.Time `json:"updated_at"`
+
+	path string
+}
+
+// sessionCatalog is implemented by stores able to enumerate every cached session,
+// including the ones belonging to other tenants.
+type sessionCatalog interface {
+	ListSessions() ([]CachedSession, error)
+	LoadSession(session CachedSession) (*Authentication, error)
+	RemoveSession(session CachedSession) error
+}
+
+// ListCachedSessions lists the sessions cached in the default app data store,
+// for every tenant. No network access is performed.
+func ListCachedSessions() ([]CachedSession, error) {
+	dir, err := defaultAppDataPath()
+	if err != nil {
+		return nil, err
+	}
+
+	logger := &loggerWrapper{underlying: &noOpLogger{}}
+	if os.Getenv(EnvStoreDir) == "" {
+		migrateLegacyAppData(dir, logger)
+	}
+	return listSessionsInDir(dir, hostBinding{}, logger)
+}
+
+// ListCachedSessions lists the sessions cached in the configured store, for every tenant.
+func (a *DefaultImpl) ListCachedSessions() ([]CachedSession, error) {
+	catalog, err := a.sessionCatalog()
+	if err != nil {
+		return nil, err
+	}
+	return catalog.ListSessions()
+}
+
+func (a *DefaultImpl) sessionCatalog() (sessionCatalog, error) {
+	if a.store == nil {
+		return nil, errors.New("missing store implementation")
+	}
+	catalog, ok := a.store.(sessionCatalog)
+	if !ok {
+		return nil, errors.New("the configured store does not support listing sessions")
+	}
+	return catalog, nil
+}
+
+func listSessionsInDir(dir string, binding hostBinding, logger *loggerWrapper) ([]CachedSession, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, errors.Wrap(err, "error listing the store directory")
+	}
+
+	metadataByKey := make(map[string]*SessionMetadata)
+	var sessions []CachedSession
+
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !isSessionFileName(name) {
+			continue
+		}
+
+		key := strings.TrimSuffix(name, sessionFileSuffix)
+		active := true
+		if i := strings.Index(key, "@"); i >= 0 {
+			key = key[:i]
+			active = false
+		}
+
+		p := path.Join(dir, name)
+		authentication, envelope, err := readStoredAuthenticationFile(p)
+		if err != nil {
+			logger.Warningf("skipping unreadable session file %s: %v", p, err)
+			continue
+		}
+		if !binding.accepts(envelope) {
+			binding.refuse(p, key, *authentication, logger)
+			continue
+		}
+
+		session := CachedSession{
+			Key:             key,
+			Email:           authentication.User.Email,
+			Sub:             authentication.User.Sub,
+			Active:          active,
+			ExpiresAt:       authentication.Tokens.ExpiresAt,
+			HasRefreshToken: authentication.Tokens.RefreshToken != "",
+			path:            p,
+		}
+		if !envelope.UpdatedAt.IsZero() {
+			session.UpdatedAt = envelope.UpdatedAt
+		} else if info, err := entry.Info(); err == nil {
+			session.UpdatedAt = info.ModTime()
+		}
+
+		metadata, ok := metadataByKey[key]
+		if !ok {
+			metadata = readMetadataFile(path.Join(dir, key+metadataFileSuffix))
+			metadataByKey[key] = metadata
+		}
+		if metadata != nil {
+			session.SessionMetadata = *metadata
+		}
+
+		sessions = append(sessions, session)
+	}
+
+	sort.SliceStable(sessions, func(i, j int) bool {
+		if sessions[i].Key != sessions[j].Key {
+			return sessions[i].Key < sessions[j].Key
+		}
+		return sessions[i].Active && !sessions[j].Active
+	})
+
+	return sessions, nil
+}
+
+func isSessionFileName(name string) bool {
+	return strings.HasSuffix(name, sessionFileSuffix) &&
+		!strings.HasSuffix(name, metadataFileSuffix) &&
+		!strings.HasSuffix(name, pendingFlowFileSuffix)
+}
+
+func readMetadataFile(p string) *SessionMetadata {
+	serialized, err := os.ReadFile(p)
+	if err != nil {
+		return nil
+	}
+
+	var metadata SessionMetadata
+	if err = json.Unmarshal(serialized, &metadata); err != nil {
+		return nil
+	}
+	return &metadata
+}
@@ -0,0 +1,277 @@
+package auth0cliauthorizer
+
+import (
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// StoreFactory builds the store for the given key, which identifies a tenant
+// or, when used with WithSecureStore, one of its accounts.
+type StoreFactory func(key string) (Store, error)
+
+// secureStoreRefreshToken takes the place of the refresh token in the primary store
+// when the actual one is kept in the secure store.
+const secureStoreRefreshToken = "secure-store"
+
+// splitStore keeps the refresh tokens in a secure store and everything else in the primary one.
+type splitStore struct {
+	// mu keeps the two stores consistent with each other
+	mu      sync.Mutex
+	key     string
+	primary Store
+	secure  StoreFactory
+	logger  *loggerWrapper
+}
+
+var _ Store = &splitStore{}
+var _ pendingFlowStore = &splitStore{}
+var _ accountStore = &splitStore{}
+var _ sessionCatalog = &splitStore{}
+var _ watchableStore = &splitStore{}
+var _ hostBindableStore = &splitStore{}
+
+func newSplitStore(key string, primary Store, secure StoreFactory, logger *loggerWrapper) *splitStore {
+	return &splitStore{
+		key:     key,
+		primary: primary,
+		secure:  secure,
+		logger:  logger,
+	}
+}
+
+func (s *splitStore) secureStore(key, sub string) (Store, error) {
+	if sub != "" {
+		key += "@" + hashAccount(sub)
+	}
+	secure, err := s.secure(key)
+	if err != nil {
+		return nil, errors.Wrap(err, "error building the secure store")
+	}
+	return secure, nil
+}
+
+func (s *splitStore) Save(authentication Authentication) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	secure, err := s.secureStore(s.key, authentication.User.Sub)
+	if err != nil {
+		return err
+	}
+
+	if authentication.Tokens.RefreshToken == "" {
+		if err = secure.Clear(); err != nil {
+			return errors.Wrap(err, "error removing the refresh token from the secure store")
+		}
+	} else {
+		err = secure.Save(Authentication{
+			User:   User{Sub: authentication.User.Sub},
+			Tokens: Tokens{RefreshToken: authentication.Tokens.RefreshToken},
+		})
+		if err != nil {
+			return errors.Wrap(err, "error saving the refresh token to the secure store")
+		}
+		authentication.Tokens.RefreshToken = secureStoreRefreshToken
+	}
+
+	return s.primary.Save(authentication)
+}
+
+func (s *splitStore) Load() (*Authentication, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	loaded, err := s.primary.Load()
+	if err != nil || loaded == nil {
+		return loaded, err
+	}
+
+	if err = s.resolveRefreshToken(s.key, loaded); err != nil {
+		return nil, err
+	}
+	return loaded, nil
+}
+
+// resolveRefreshToken replaces the placeholder with the refresh token from the secure store.
+// Entries saved before the secure store was configured hold the actual token and are left as they are.
+func (s *splitStore) resolveRefreshToken(key string, authentication *Authentication) error {
+	if authentication.Tokens.RefreshToken != secureStoreRefreshToken {
+		return nil
+	}
+	authentication.Tokens.RefreshToken = ""
+
+	secure, err := s.secureStore(key, authentication.User.Sub)
+	if err != nil {
+		return err
+	}
+
+	stored, err := secure.Load()
+	if err != nil {
+		return errors.Wrap(err, "error loading the refresh token from the secure store")
+	}
+	if stored == nil || stored.User.Sub != authentication.User.Sub {
+		s.logger.Warningf("the refresh token of %s is missing from the secure store", authentication.User.Email)
+		return nil
+	}
+
+	authentication.Tokens.RefreshToken = stored.Tokens.RefreshToken
+	return nil
+}
+
+func (s *splitStore) clearSecure(key, sub string) error {
+	secure, err := s.secureStore(key, sub)
+	if err != nil {
+		return err
+	}
+	if err = secure.Clear(); err != nil {
+		return errors.Wrap(err, "error removing the refresh token from the secure store")
+	}
+	return nil
+}
+
+func (s *splitStore) Clear() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	loaded, err := s.primary.Load()
+	if err != nil {
+		s.logger.Warningf("error loading the authentication to clear from the secure store: %v", err)
+	} else if loaded != nil {
+		if err = s.clearSecure(s.key, loaded.User.Sub); err != nil {
+			return err
+		}
+	}
+
+	return s.primary.Clear()
+}
+
+func (s *splitStore) SavePendingFlow(flow pendingDeviceFlow) error {
+	if pending, ok := s.primary.(pendingFlowStore); ok {
+		return pending.SavePendingFlow(flow)
+	}
+	return nil
+}
+
+func (s *splitStore) LoadPendingFlow() (*pendingDeviceFlow, error) {
+	if pending, ok := s.primary.(pendingFlowStore); ok {
+		return pending.LoadPendingFlow()
+	}
+	return nil, nil
+}
+
+func (s *splitStore) ClearPendingFlow() error {
+	if pending, ok := s.primary.(pendingFlowStore); ok {
+		return pending.ClearPendingFlow()
+	}
+	return nil
+}
+
+func (s *splitStore) ListAccounts() ([]Authentication, error) {
+	accounts, ok := s.primary.(accountStore)
+	if !ok {
+		return nil, ErrAccountsNotSupported
+	}
+
+	stored, err := accounts.ListAccounts()
+	if err != nil {
+		return nil, err
+	}
+	for i := range stored {
+		if err = s.resolveRefreshToken(s.key, &stored[i]); err != nil {
+			return nil, err
+		}
+	}
+	return stored, nil
+}
+
+func (s *splitStore) ActivateAccount(sub string) error {
+	accounts, ok := s.primary.(accountStore)
+	if !ok {
+		return ErrAccountsNotSupported
+	}
+	return accounts.ActivateAccount(sub)
+}
+
+func (s *splitStore) ClearAccount(sub string) error {
+	accounts, ok := s.primary.(accountStore)
+	if !ok {
+		return ErrAccountsNotSupported
+	}
+
+	if err := s.clearSecure(s.key, sub); err != nil {
+		return err
+	}
+	return accounts.ClearAccount(sub)
+}
+
+func (s *splitStore) ListSessions() ([]CachedSession, error) {
+	catalog, err := s.catalog()
+	if err != nil {
+		return nil, err
+	}
+	return catalog.ListSessions()
+}
+
+func (s *splitStore) LoadSession(session CachedSession) (*Authentication, error) {
+	catalog, err := s.catalog()
+	if err != nil {
+		return nil, err
+	}
+
+	loaded, err := catalog.LoadSession(session)
+	if err != nil || loaded == nil {
+		return loaded, err
+	}
+	if err = s.resolveRefreshToken(session.Key, loaded); err != nil {
+		return nil, err
+	}
+	return loaded, nil
+}
+
+func (s *splitStore) RemoveSession(session CachedSession) error {
+	catalog, err := s.catalog()
+	if err != nil {
+		return err
+	}
+
+	if err = s.clearSecure(session.Key, session.Sub); err != nil {
+		return err
+	}
+	return catalog.RemoveSession(session)
+}
+
+func (s *splitStore) catalog() (sessionCatalog, error) {
+	catalog, ok := s.primary.(sessionCatalog)
+	if !ok {
+		return nil, errors.New("the configured store does not support listing sessions")
+	}
+	return catalog, nil
+}
+
+// watchTarget returns an empty dir when the primary store can't be watched.
+func (s *splitStore) watchTarget() (string, func(name string) bool) {
+	if watchable, ok := s.primary.(watchableStore); ok {
+		return watchable.watchTarget()
+	}
+	return "", nil
+}
+
+// bindToHost also removes the refresh tokens of the entries refused by the primary store.
+func (s *splitStore) bindToHost(binding hostBinding) error {
+	bindable, ok := s.primary.(hostBindableStore)
+	if !ok {
+		return errHostBindingNotSupported
+	}
+
+	onRefused := binding.onRefused
+	binding.onRefused = func(key string, authentication Authentication) {
+		if err := s.clearSecure(key, authentication.User.Sub); err != nil {
+			s.logger.Warningf("error removing the refused refresh token: %v", err)
+		}
+		if onRefused != nil {
+			onRefused(key, authentication)
+		}
+	}
+	return bindable.bindToHost(binding)
+}
@@ -1,78 +1,171 @@
 package auth0cliauthorizer
 
 import (
+	"crypto/md5"
+	"encoding/hex"
 	"encoding/json"
 	"os"
 	"path"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/pkg/errors"
 )
 
-type store interface {
+const (
+	// EnvStoreDir overrides the directory of the app data store.
+	EnvStoreDir = "AUTH0_CLI_AUTH_STORE_DIR"
+
+	storeDirName = "auth0-cli-auth"
+)
+
+// Store persists the authentication of a single tenant.
+// Load returns nil and no error when nothing is stored.
+type Store interface {
 	Save(authentication Authentication) error
 	Load() (*Authentication, error)
 	Clear() error
 }
 
+// accountStore is implemented by stores able to keep several accounts per tenant.
+// Load and Save always refer to the active account.
+type accountStore interface {
+	ListAccounts() ([]Authentication, error)
+	ActivateAccount(sub string) error
+	ClearAccount(sub string) error
+}
+
+// pendingFlowStore is implemented by stores able to persist an in-progress
+// device flow, so that it can be resumed after a restart.
+type pendingFlowStore interface {
+	SavePendingFlow(flow pendingDeviceFlow) error
+	LoadPendingFlow() (*pendingDeviceFlow, error)
+	ClearPendingFlow() error
+}
+
+type pendingDeviceFlow struct {
+	DeviceCode              string    `json:"device_code"`
+	UserCode                string    `json:"user_code"`
+	VerificationUri         string    `json:"verification_uri"`
+	VerificationUriComplete string    `json:"verification_uri_complete"`
+	Interval                int       `json:"interval"`
+	ExpiresAt               time.Time `json:"expires_at"`
+}
+
 type fileSystemStore struct {
-	tenant   string
-	basePath string
-	logger   *loggerWrapper
+	// mu serializes the operations on the files of the tenant
+	mu        sync.Mutex
+	tenant    string
+	directory string
+	metadata  *SessionMetadata
+	// binding ties the entries to the host, when its fingerprint is set
+	binding hostBinding
+	logger  *loggerWrapper
 }
 
-var _ store = &fileSystemStore{}
+var _ Store = &fileSystemStore{}
+var _ pendingFlowStore = &fileSystemStore{}
+var _ accountStore = &fileSystemStore{}
+var _ sessionCatalog = &fileSystemStore{}
+var _ watchableStore = &fileSystemStore{}
+var _ hostBindableStore = &fileSystemStore{}
 
-func newFileSystemStore(tenant, basePath string, logger *loggerWrapper) (*fileSystemStore, error) {
-	if tenant == "" || basePath == "" {
-		return nil, errors.New("missing tenant or basePath")
+func newFileSystemStore(tenant, directory string, metadata *SessionMetadata, logger *loggerWrapper) (*fileSystemStore, error) {
+	if tenant == "" || directory == "" {
+		return nil, errors.New("missing tenant or directory")
 	}
 
 	s := &fileSystemStore{
-		tenant:   tenant,
-		basePath: basePath,
-		logger:   logger,
+		tenant:    tenant,
+		directory: directory,
+		metadata:  metadata,
+		logger:    logger,
 	}
 
-	p := s.fullPath()
-	pPath := path.Dir(p)
-
-	err := os.MkdirAll(pPath, os.ModePerm)
+	err := os.MkdirAll(directory, 0700)
 	if err != nil {
-		return nil, errors.Errorf("could not create directory %s", pPath)
+		return nil, errors.Errorf("could not create directory %s", directory)
 	}
 
 	return s, nil
 }
 
+func (f *fileSystemStore) dir() string {
+	return f.directory
+}
+
+func (f *fileSystemStore) watchTarget() (string, func(name string) bool) {
+	return f.dir(), func(name string) bool {
+		return name == path.Base(f.fullPath())
+	}
+}
+
+func (f *fileSystemStore) bindToHost(binding hostBinding) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.binding = binding
+	return nil
+}
+
 func (f *fileSystemStore) fullPath() string {
-	return path.Join(f.basePath, "auth0-cli-auth", f.tenant+".json")
+	return path.Join(f.dir(), f.tenant+".json")
+}
+
+func (f *fileSystemStore) accountPath(sub string) string {
+	return path.Join(f.dir(), f.tenant+"@"+hashAccount(sub)+".json")
 }
 
 func (f *fileSystemStore) Save(authentication Authentication) error {
-	if f.tenant == "" || f.basePath == "" {
-		return errors.New("missing tenant or basePath")
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.save(authentication)
+}
+
+func (f *fileSystemStore) save(authentication Authentication) error {
+	if f.tenant == "" || f.directory == "" {
+		return errors.New("missing tenant or directory")
 	}
 
-	serialized, err := json.MarshalIndent(authentication, "", "  ")
-	if err != nil {
-		return errors.Wrap(err, "error serializing authentication")
+	// a different account being saved: the previous one is parked instead of being overwritten
+	if err := f.parkActiveAccount(authentication.User.Sub); err != nil {
+		return err
 	}
 
 	p := f.fullPath()
 	f.logger.Debugf("saving authentication to %s", p)
 
-	err = os.WriteFile(p, serialized, 0644)
-	if err != nil {
-		return errors.Wrap(err, "error writing to file")
+	if err := writeAuthenticationFile(p, authentication, f.binding.fingerprint); err != nil {
+		return err
 	}
 	f.logger.Debugf("saved authentication to %s", p)
 
+	if authentication.User.Sub != "" {
+		if err := removeIfExists(f.accountPath(authentication.User.Sub)); err != nil {
+			return errors.Wrap(err, "error removing the parked account file")
+		}
+	}
+
+	if f.metadata != nil {
+		if err := f.writeMetadata(*f.metadata); err != nil {
+			f.logger.Warningf("error saving session metadata: %v", err)
+		}
+	}
+
 	return nil
 }
 
 func (f *fileSystemStore) Load() (*Authentication, error) {
-	if f.tenant == "" || f.basePath == "" {
-		return nil, errors.New("missing tenant or basePath")
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.load()
+}
+
+func (f *fileSystemStore) load() (*Authentication, error) {
+	if f.tenant == "" || f.directory == "" {
+		return nil, errors.New("missing tenant or directory")
 	}
 
 	p := f.fullPath()
@@ -83,23 +176,49 @@ func (f *fileSystemStore) Load() (*Authentication, error) {
 
 	f.logger.Debugf("loading authentication from %s", p)
 
-	serialized, err := os.ReadFile(p)
+	deserialized, envelope, err := readStoredAuthenticationFile(p)
+	if errors.Is(err, errUnsupportedSchemaVersion) {
+		f.logger.Warningf("ignoring authentication stored in %s: %v", p, err)
+		return nil, nil
+	}
 	if err != nil {
-		return nil, errors.Wrap(err, "error reading from file")
+		return nil, err
 	}
 
-	var deserialized Authentication
-	err = json.Unmarshal(serialized, &deserialized)
-	if err != nil {
-		return nil, errors.Wrap(err, "error deserializing authentication")
+	if !f.binding.accepts(envelope) {
+		f.binding.refuse(p, f.tenant, *deserialized, f.logger)
+		if err = f.removeUnusedMetadata(); err != nil {
+			f.logger.Warningf("error removing session metadata: %v", err)
+		}
+		return nil, nil
+	}
+
+	if envelope.SchemaVersion < currentSchemaVersion {
+		f.logger.Debugf("upgrading authentication stored in %s from schema version %d to %d",
+			p, envelope.SchemaVersion, currentSchemaVersion)
+		if err = writeAuthenticationFile(p, *deserialized, f.binding.fingerprint); err != nil {
+			f.logger.Warningf("error upgrading the stored authentication: %v", err)
+		}
+	} else if f.binding.fingerprint != "" && envelope.HostFingerprint == "" {
+		// written before the binding was enabled
+		f.logger.Debugf("binding authentication stored in %s to this host", p)
+		if err = writeAuthenticationFile(p, *deserialized, f.binding.fingerprint); err != nil {
+			f.logger.Warningf("error binding the stored authentication: %v", err)
+		}
 	}
 
 	f.logger.Debugf("loaded authentication from %s", p)
 
-	return &deserialized, nil
+	return deserialized, nil
 }
 
 func (f *fileSystemStore) Clear() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.clear()
+}
+
+func (f *fileSystemStore) clear() error {
 	p := f.fullPath()
 	if checkFileExists(p) {
 		f.logger.Debugf("removing authentication stored in %s", p)
@@ -107,51 +226,407 @@ func (f *fileSystemStore) Clear() error {
 			return errors.Wrap(err, "error removing authentication file")
 		}
 	}
+	return f.removeUnusedMetadata()
+}
+
+func (f *fileSystemStore) ListAccounts() ([]Authentication, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var accounts []Authentication
+
+	active, err := f.load()
+	if err != nil {
+		return nil, err
+	}
+	if active != nil {
+		accounts = append(accounts, *active)
+	}
+
+	entries, err := os.ReadDir(f.dir())
+	if err != nil {
+		return nil, errors.Wrap(err, "error listing the store directory")
+	}
+
+	prefix := f.tenant + "@"
+	refused := false
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasPrefix(entry.Name(), prefix) || !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+		p := path.Join(f.dir(), entry.Name())
+		parked, envelope, err := readStoredAuthenticationFile(p)
+		if err != nil {
+			f.logger.Warningf("skipping unreadable account file %s: %v", entry.Name(), err)
+			continue
+		}
+		if !f.binding.accepts(envelope) {
+			f.binding.refuse(p, f.tenant, *parked, f.logger)
+			refused = true
+			continue
+		}
+		accounts = append(accounts, *parked)
+	}
+
+	if refused {
+		if err = f.removeUnusedMetadata(); err != nil {
+			f.logger.Warningf("error removing session metadata: %v", err)
+		}
+	}
+
+	return accounts, nil
+}
+
+func (f *fileSystemStore) ActivateAccount(sub string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	active, err := f.load()
+	if err != nil {
+		return err
+	}
+	if active != nil && active.User.Sub == sub {
+		return nil
+	}
+
+	p := f.accountPath(sub)
+	if !checkFileExists(p) {
+		return ErrAccountNotFound
+	}
+
+	if err = f.parkActiveAccount(sub); err != nil {
+		return err
+	}
+
+	f.logger.Debugf("activating account stored in %s", p)
+	if err = os.Rename(p, f.fullPath()); err != nil {
+		return errors.Wrap(err, "error activating the account file")
+	}
+	return nil
+}
+
+func (f *fileSystemStore) ClearAccount(sub string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	active, err := f.load()
+	if err != nil {
+		return err
+	}
+	if active != nil && active.User.Sub == sub {
+		return f.clear()
+	}
+
+	p := f.accountPath(sub)
+	f.logger.Debugf("removing account stored in %s", p)
+	if err = removeIfExists(p); err != nil {
+		return errors.Wrap(err, "error removing account file")
+	}
+	return f.removeUnusedMetadata()
+}
+
+func (f *fileSystemStore) parkActiveAccount(incomingSub string) error {
+	active, err := f.load()
+	if err != nil || active == nil || active.User.Sub == "" || active.User.Sub == incomingSub {
+		return nil
+	}
+
+	p := f.accountPath(active.User.Sub)
+	f.logger.Debugf("parking the previously active account in %s", p)
+	if err = os.Rename(f.fullPath(), p); err != nil {
+		return errors.Wrap(err, "error parking the previously active account")
+	}
+	return nil
+}
+
+func (f *fileSystemStore) ListSessions() ([]CachedSession, error) {
+	return listSessionsInDir(f.dir(), f.binding, f.logger)
+}
+
+func (f *fileSystemStore) LoadSession(session CachedSession) (*Authentication, error) {
+	if session.path == "" || path.Dir(session.path) != f.dir() {
+		return nil, errors.New("the session does not belong to this store")
+	}
+
+	loaded, envelope, err := readStoredAuthenticationFile(session.path)
+	if err != nil {
+		return nil, err
+	}
+	if !f.binding.accepts(envelope) {
+		f.binding.refuse(session.path, session.Key, *loaded, f.logger)
+		return nil, errSessionBoundElsewhere
+	}
+	return loaded, nil
+}
+
+func (f *fileSystemStore) RemoveSession(session CachedSession) error {
+	if session.path == "" || path.Dir(session.path) != f.dir() {
+		return errors.New("the session does not belong to this store")
+	}
+
+	f.logger.Debugf("removing session stored in %s", session.path)
+	if err := removeIfExists(session.path); err != nil {
+		return errors.Wrap(err, "error removing session file")
+	}
+
+	other := &fileSystemStore{
+		tenant:    session.Key,
+		directory: f.directory,
+		logger:    f.logger,
+	}
+	return other.removeUnusedMetadata()
+}
+
+func (f *fileSystemStore) metadataPath() string {
+	return path.Join(f.dir(), f.tenant+metadataFileSuffix)
+}
+
+func (f *fileSystemStore) writeMetadata(metadata SessionMetadata) error {
+	serialized, err := json.MarshalIndent(metadata, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "error serializing session metadata")
+	}
+
+	if err = os.WriteFile(f.metadataPath(), serialized, 0644); err != nil {
+		return errors.Wrap(err, "error writing to file")
+	}
+	return nil
+}
+
+// removeUnusedMetadata drops the metadata once no account is left for the tenant.
+func (f *fileSystemStore) removeUnusedMetadata() error {
+	if checkFileExists(f.fullPath()) {
+		return nil
+	}
+
+	entries, err := os.ReadDir(f.dir())
+	if err != nil {
+		return errors.Wrap(err, "error listing the store directory")
+	}
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), f.tenant+"@") {
+			return nil
+		}
+	}
+
+	if err = removeIfExists(f.metadataPath()); err != nil {
+		return errors.Wrap(err, "error removing session metadata")
+	}
+	return nil
+}
+
+func (f *fileSystemStore) pendingFlowPath() string {
+	return path.Join(f.dir(), f.tenant+pendingFlowFileSuffix)
+}
+
+func (f *fileSystemStore) SavePendingFlow(flow pendingDeviceFlow) error {
+	serialized, err := json.MarshalIndent(flow, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "error serializing pending device flow")
+	}
+
+	p := f.pendingFlowPath()
+	f.logger.Debugf("saving pending device flow to %s", p)
+
+	if err = os.WriteFile(p, serialized, 0600); err != nil {
+		return errors.Wrap(err, "error writing to file")
+	}
+	return nil
+}
+
+func (f *fileSystemStore) LoadPendingFlow() (*pendingDeviceFlow, error) {
+	p := f.pendingFlowPath()
+	if !checkFileExists(p) {
+		return nil, nil
+	}
+
+	serialized, err := os.ReadFile(p)
+	if err != nil {
+		return nil, errors.Wrap(err, "error reading from file")
+	}
+
+	var deserialized pendingDeviceFlow
+	if err = json.Unmarshal(serialized, &deserialized); err != nil {
+		return nil, errors.Wrap(err, "error deserializing pending device flow")
+	}
+
+	return &deserialized, nil
+}
+
+func (f *fileSystemStore) ClearPendingFlow() error {
+	p := f.pendingFlowPath()
+	if checkFileExists(p) {
+		f.logger.Debugf("removing pending device flow stored in %s", p)
+		if err := os.Remove(p); err != nil {
+			return errors.Wrap(err, "error removing pending device flow file")
+		}
+	}
 	return nil
 }
 
 type appDataStore struct {
-	underlying store
-	// TODO
+	*fileSystemStore
 }
 
-var _ store = &appDataStore{}
+var _ Store = &appDataStore{}
+var _ pendingFlowStore = &appDataStore{}
+var _ accountStore = &appDataStore{}
+var _ sessionCatalog = &appDataStore{}
 
-func newAppDataStore(tenant string, logger *loggerWrapper) (*appDataStore, error) {
+func newAppDataStore(tenant string, metadata SessionMetadata, logger *loggerWrapper) (*appDataStore, error) {
 	if tenant == "" {
-		return nil, errors.New("missing tenant or basePath")
+		return nil, errors.New("missing tenant")
 	}
 
-	path, err := os.UserCacheDir()
+	dir, err := defaultAppDataPath()
 	if err != nil {
-		return nil, errors.Wrap(err, "error detecting the user cache dir")
+		return nil, err
 	}
 
-	logger.Debugf("selected %s as app data folder", path)
+	logger.Debugf("selected %s as app data folder", dir)
 
-	underlying, err := newFileSystemStore(tenant, path, logger)
+	underlying, err := newFileSystemStore(tenant, dir, &metadata, logger)
 	if err != nil {
 		return nil, errors.Wrap(err, "error building the underlying file system store")
 	}
 
+	if os.Getenv(EnvStoreDir) == "" {
+		migrateLegacyAppData(dir, logger)
+	}
+
 	return &appDataStore{
-		underlying: underlying,
+		fileSystemStore: underlying,
 	}, nil
 }
 
-func (a appDataStore) Save(authentication Authentication) error {
-	return a.underlying.Save(authentication)
+// defaultAppDataPath returns the directory of the app data store: the one in
+// AUTH0_CLI_AUTH_STORE_DIR if set, otherwise $XDG_STATE_HOME/auth0-cli-auth,
+// falling back to ~/.local/state on unix and to the user config dir elsewhere.
+func defaultAppDataPath() (string, error) {
+	if dir := os.Getenv(EnvStoreDir); dir != "" {
+		return dir, nil
+	}
+
+	stateDir := os.Getenv("XDG_STATE_HOME")
+	if stateDir == "" {
+		var err error
+		switch runtime.GOOS {
+		case "windows", "darwin", "ios", "plan9":
+			stateDir, err = os.UserConfigDir()
+			if err != nil {
+				return "", errors.Wrap(err, "error detecting the user config dir")
+			}
+		default:
+			home, err := os.UserHomeDir()
+			if err != nil {
+				return "", errors.Wrap(err, "error detecting the user home dir")
+			}
+			stateDir = filepath.Join(home, ".local", "state")
+		}
+	}
+
+	return filepath.Join(stateDir, storeDirName), nil
 }
 
-func (a appDataStore) Load() (*Authentication, error) {
-	return a.underlying.Load()
+// legacyAppDataPath is where the app data store lived before moving out of the cache dir.
+func legacyAppDataPath() (string, error) {
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return "", errors.Wrap(err, "error detecting the user cache dir")
+	}
+	return filepath.Join(cacheDir, storeDirName), nil
 }
 
-func (a appDataStore) Clear() error {
-	return a.underlying.Clear()
+// migrateLegacyAppData moves the files left in the legacy location to dir,
+// never overwriting the ones already there. Failures are logged and ignored,
+// at worst the user is asked to log in again.
+func migrateLegacyAppData(dir string, logger *loggerWrapper) {
+	legacyDir, err := legacyAppDataPath()
+	if err != nil || filepath.Clean(legacyDir) == filepath.Clean(dir) {
+		return
+	}
+
+	entries, err := os.ReadDir(legacyDir)
+	if err != nil {
+		return
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), sessionFileSuffix) {
+			continue
+		}
+
+		from := filepath.Join(legacyDir, entry.Name())
+		to := filepath.Join(dir, entry.Name())
+		if checkFileExists(to) {
+			continue
+		}
+
+		logger.Debugf("migrating %s to %s", from, to)
+		if err = moveFile(from, to); err != nil {
+			logger.Warningf("error migrating %s to %s: %v", from, to, err)
+		}
+	}
+
+	// only succeeds once the legacy directory is empty
+	_ = os.Remove(legacyDir)
+}
+
+// moveFile falls back to copying when renaming is not possible, e.g. across devices.
+func moveFile(from, to string) error {
+	if err := os.Rename(from, to); err == nil {
+		return nil
+	}
+
+	info, err := os.Stat(from)
+	if err != nil {
+		return err
+	}
+	content, err := os.ReadFile(from)
+	if err != nil {
+		return err
+	}
+	if err = os.WriteFile(to, content, info.Mode().Perm()); err != nil {
+		return err
+	}
+	return os.Remove(from)
 }
 
 func checkFileExists(filePath string) bool {
 	_, err := os.Stat(filePath)
 	return !errors.Is(err, os.ErrNotExist)
 }
+
+// writeFileAtomic replaces the file at once, so that readers never see it half-written.
+func writeFileAtomic(p string, content []byte, perm os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(p), "."+filepath.Base(p)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err = tmp.Write(content); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	if err = os.Chmod(tmp.Name(), perm); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), p)
+}
+
+func removeIfExists(filePath string) error {
+	if err := os.Remove(filePath); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func hashAccount(sub string) string {
+	h := md5.New()
+	h.Write([]byte(sub))
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,406 @@
+package auth0cliauthorizer_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"testing"
+
+	authorizer "github.com/fabiofenoglio/auth0-cli-authorizer"
+	"github.com/fabiofenoglio/auth0-cli-authorizer/storetest"
+)
+
+const testTenant = "0123456789abcdef0123456789abcdef"
+
+func TestFileSystemStore(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) authorizer.Store {
+		store, err := authorizer.NewFileSystemStoreForTest(testTenant, t.TempDir())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return store
+	})
+}
+
+func TestAppDataStore(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) authorizer.Store {
+		t.Setenv(authorizer.EnvStoreDir, t.TempDir())
+
+		store, err := authorizer.NewAppDataStoreForTest(testTenant)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return store
+	})
+}
+
+func TestMemoryStore(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) authorizer.Store {
+		return newStoreFromURL(t, "memory://")
+	})
+}
+
+func TestEncryptedFileStore(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) authorizer.Store {
+		store, err := authorizer.NewEncryptedFileStoreFactory(t.TempDir(), []byte("secret"))(testTenant)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return store
+	})
+}
+
+func TestSplitStore(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) authorizer.Store {
+		primary, err := authorizer.NewFileSystemStoreForTest(testTenant, t.TempDir())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return authorizer.NewSplitStoreForTest(testTenant, primary, authorizer.NewEncryptedFileStoreFactory(t.TempDir(), []byte("secret")))
+	})
+}
+
+func newStoreFromURL(t *testing.T, url string) authorizer.Store {
+	factory, err := authorizer.NewStoreFactoryFromURL(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store, err := factory(testTenant)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return store
+}
+
+func TestHostBindingRefusesForeignEntries(t *testing.T) {
+	dir := t.TempDir()
+	mustSaveBound(t, testTenant, dir, "host-a", storetest.Authentication("alice"))
+
+	store := newBoundFileSystemStore(t, testTenant, dir, "host-b")
+	catalog := store.(authorizer.SessionCatalogForTest)
+
+	sessions, err := catalog.ListSessions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sessions) != 0 {
+		t.Fatalf("expected the foreign session to be refused, got %+v", sessions)
+	}
+	if loaded, err := store.Load(); err != nil || loaded != nil {
+		t.Fatalf("expected the foreign session to be refused, got %v, %v", loaded, err)
+	}
+}
+
+func TestHostBindingRefusesForeignSessionOnLoadSession(t *testing.T) {
+	dir := t.TempDir()
+	mustSaveBound(t, testTenant, dir, "host-a", storetest.Authentication("alice"))
+
+	sessions, err := newBoundFileSystemStore(t, testTenant, dir, "host-a").(authorizer.SessionCatalogForTest).ListSessions()
+	if err != nil || len(sessions) != 1 {
+		t.Fatalf("expected one session, got %v, %v", sessions, err)
+	}
+
+	catalog := newBoundFileSystemStore(t, testTenant, dir, "host-b").(authorizer.SessionCatalogForTest)
+	if loaded, err := catalog.LoadSession(sessions[0]); err == nil || loaded != nil {
+		t.Fatalf("expected the foreign session to be refused, got %v, %v", loaded, err)
+	}
+}
+
+func TestHostBindingAcceptsOwnEntries(t *testing.T) {
+	dir := t.TempDir()
+	expected := storetest.Authentication("alice")
+	mustSaveBound(t, testTenant, dir, "host-a", expected)
+
+	loaded, err := newBoundFileSystemStore(t, testTenant, dir, "host-a").Load()
+	if err != nil || loaded == nil || loaded.Tokens.RefreshToken != expected.Tokens.RefreshToken {
+		t.Fatalf("expected the session to be loaded, got %v, %v", loaded, err)
+	}
+}
+
+func TestHostBindingSplitStoreClearsRefusedRefreshToken(t *testing.T) {
+	dir, secureDir := t.TempDir(), t.TempDir()
+	secure := authorizer.NewEncryptedFileStoreFactory(secureDir, []byte("secret"))
+
+	writer := authorizer.NewSplitStoreForTest(testTenant, newFileSystemStore(t, testTenant, dir), secure)
+	if err := authorizer.BindToHostForTest(writer, "host-a"); err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.Save(storetest.Authentication("alice")); err != nil {
+		t.Fatal(err)
+	}
+	if entries, _ := os.ReadDir(secureDir); len(entries) != 1 {
+		t.Fatalf("expected the refresh token in the secure store, got %d entries", len(entries))
+	}
+
+	reader := authorizer.NewSplitStoreForTest(testTenant, newFileSystemStore(t, testTenant, dir), secure)
+	if err := authorizer.BindToHostForTest(reader, "host-b"); err != nil {
+		t.Fatal(err)
+	}
+	if loaded, err := reader.Load(); err != nil || loaded != nil {
+		t.Fatalf("expected the foreign session to be refused, got %v, %v", loaded, err)
+	}
+	if entries, _ := os.ReadDir(secureDir); len(entries) != 0 {
+		t.Fatalf("expected the refused refresh token to be removed, got %d entries", len(entries))
+	}
+}
+
+func newFileSystemStore(t *testing.T, tenant, dir string) authorizer.Store {
+	store, err := authorizer.NewFileSystemStoreForTest(tenant, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return store
+}
+
+func newBoundFileSystemStore(t *testing.T, tenant, dir, fingerprint string) authorizer.Store {
+	store := newFileSystemStore(t, tenant, dir)
+	if err := authorizer.BindToHostForTest(store, fingerprint); err != nil {
+		t.Fatal(err)
+	}
+	return store
+}
+
+func mustSaveBound(t *testing.T, tenant, dir, fingerprint string, authentication authorizer.Authentication) {
+	if err := newBoundFileSystemStore(t, tenant, dir, fingerprint).Save(authentication); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFileSystemStoreMigratesLegacyFile(t *testing.T) {
+	dir := t.TempDir()
+	expected := storetest.Authentication("alice")
+
+	legacy, err := json.MarshalIndent(expected, "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := filepath.Join(dir, testTenant+".json")
+	if err = os.WriteFile(p, legacy, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := newFileSystemStore(t, testTenant, dir).Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded == nil || !reflect.DeepEqual(*loaded, expected) {
+		t.Fatalf("expected the legacy authentication to be loaded, got %+v", loaded)
+	}
+
+	var envelope struct {
+		SchemaVersion int `json:"schema_version"`
+	}
+	if err = json.Unmarshal(mustReadFile(t, p), &envelope); err != nil {
+		t.Fatal(err)
+	}
+	if envelope.SchemaVersion != authorizer.CurrentSchemaVersionForTest {
+		t.Fatalf("expected the file to be migrated to version %d, got %d", authorizer.CurrentSchemaVersionForTest, envelope.SchemaVersion)
+	}
+}
+
+func TestFileSystemStoreRefusesNewerSchema(t *testing.T) {
+	dir := t.TempDir()
+
+	payload, err := json.Marshal(storetest.Authentication("alice"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	newer, err := json.Marshal(map[string]interface{}{
+		"schema_version": authorizer.CurrentSchemaVersionForTest + 1,
+		"authentication": json.RawMessage(payload),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := filepath.Join(dir, testTenant+".json")
+	if err = os.WriteFile(p, newer, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := newFileSystemStore(t, testTenant, dir).Load()
+	if err != nil || loaded != nil {
+		t.Fatalf("expected a cache miss, got %v, %v", loaded, err)
+	}
+	if !bytes.Equal(mustReadFile(t, p), newer) {
+		t.Fatal("expected the file written by the newer version to be left untouched")
+	}
+}
+
+func mustReadFile(t *testing.T, p string) []byte {
+	content, err := os.ReadFile(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return content
+}
+
+func TestFileSystemStoreParksAndSwitchesAccounts(t *testing.T) {
+	testAccounts(t, newFileSystemStore(t, testTenant, t.TempDir()))
+}
+
+func TestSplitStoreParksAndSwitchesAccounts(t *testing.T) {
+	primary := newFileSystemStore(t, testTenant, t.TempDir())
+	testAccounts(t, authorizer.NewSplitStoreForTest(testTenant, primary, authorizer.NewEncryptedFileStoreFactory(t.TempDir(), []byte("secret"))))
+}
+
+func testAccounts(t *testing.T, store authorizer.Store) {
+	accounts := store.(authorizer.AccountStoreForTest)
+	alice, bob := storetest.Authentication("alice"), storetest.Authentication("bob")
+
+	for _, authentication := range []authorizer.Authentication{alice, bob} {
+		if err := store.Save(authentication); err != nil {
+			t.Fatal(err)
+		}
+	}
+	assertActive(t, store, bob)
+
+	listed, err := accounts.ListAccounts()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(listed) != 2 || !reflect.DeepEqual(listed[0], bob) || !reflect.DeepEqual(listed[1], alice) {
+		t.Fatalf("expected bob active and alice parked, got %+v", listed)
+	}
+
+	if err = accounts.ActivateAccount(alice.User.Sub); err != nil {
+		t.Fatal(err)
+	}
+	assertActive(t, store, alice)
+
+	if err = accounts.ActivateAccount("auth0|nobody"); err != authorizer.ErrAccountNotFound {
+		t.Fatalf("expected ErrAccountNotFound, got %v", err)
+	}
+
+	if err = accounts.ClearAccount(bob.User.Sub); err != nil {
+		t.Fatal(err)
+	}
+	if listed, err = accounts.ListAccounts(); err != nil || len(listed) != 1 || !reflect.DeepEqual(listed[0], alice) {
+		t.Fatalf("expected only alice after clearing bob, got %+v, %v", listed, err)
+	}
+	assertActive(t, store, alice)
+}
+
+func assertActive(t *testing.T, store authorizer.Store, expected authorizer.Authentication) {
+	t.Helper()
+	loaded, err := store.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded == nil || !reflect.DeepEqual(*loaded, expected) {
+		t.Fatalf("expected %s to be the active account, got %+v", expected.User.Email, loaded)
+	}
+}
+
+// setupLegacyAppData points the app data store and its legacy location to temporary
+// directories, through the variables honored by os.UserCacheDir on unix.
+func setupLegacyAppData(t *testing.T, legacyFiles map[string]string) (stateDir, legacyDir string) {
+	switch runtime.GOOS {
+	case "windows", "darwin", "ios", "plan9":
+		t.Skip("the user cache dir does not follow XDG_CACHE_HOME on " + runtime.GOOS)
+	}
+
+	root := t.TempDir()
+	t.Setenv(authorizer.EnvStoreDir, "")
+	t.Setenv("XDG_STATE_HOME", filepath.Join(root, "state"))
+	t.Setenv("XDG_CACHE_HOME", filepath.Join(root, "cache"))
+	stateDir = filepath.Join(root, "state", "auth0-cli-auth")
+	legacyDir = filepath.Join(root, "cache", "auth0-cli-auth")
+
+	if err := os.MkdirAll(legacyDir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range legacyFiles {
+		if err := os.WriteFile(filepath.Join(legacyDir, name), []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return stateDir, legacyDir
+}
+
+func TestAppDataStoreMigratesLegacyFiles(t *testing.T) {
+	stateDir, legacyDir := setupLegacyAppData(t, map[string]string{
+		testTenant + ".json": "legacy session",
+		"other.json":         "legacy other session",
+	})
+	if err := os.MkdirAll(stateDir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(stateDir, "other.json"), []byte("current other session"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := authorizer.NewAppDataStoreForTest(testTenant); err != nil {
+		t.Fatal(err)
+	}
+
+	if content := mustReadFile(t, filepath.Join(stateDir, testTenant+".json")); string(content) != "legacy session" {
+		t.Fatalf("expected the legacy session to be moved, got %q", content)
+	}
+	if _, err := os.Stat(filepath.Join(legacyDir, testTenant+".json")); !os.IsNotExist(err) {
+		t.Fatalf("expected the legacy session to be removed from the old location, got %v", err)
+	}
+
+	// the file already in the new location wins, the legacy one is left alone
+	if content := mustReadFile(t, filepath.Join(stateDir, "other.json")); string(content) != "current other session" {
+		t.Fatalf("expected the existing session not to be overwritten, got %q", content)
+	}
+	if content := mustReadFile(t, filepath.Join(legacyDir, "other.json")); string(content) != "legacy other session" {
+		t.Fatalf("expected the clashing legacy session to be kept, got %q", content)
+	}
+}
+
+func TestAppDataStoreRemovesEmptyLegacyDir(t *testing.T) {
+	stateDir, legacyDir := setupLegacyAppData(t, map[string]string{testTenant + ".json": "legacy session"})
+
+	if _, err := authorizer.NewAppDataStoreForTest(testTenant); err != nil {
+		t.Fatal(err)
+	}
+
+	if content := mustReadFile(t, filepath.Join(stateDir, testTenant+".json")); string(content) != "legacy session" {
+		t.Fatalf("expected the legacy session to be moved, got %q", content)
+	}
+	if _, err := os.Stat(legacyDir); !os.IsNotExist(err) {
+		t.Fatalf("expected the empty legacy directory to be removed, got %v", err)
+	}
+}
+
+func TestAppDataStoreWithStoreDirSkipsMigration(t *testing.T) {
+	stateDir, legacyDir := setupLegacyAppData(t, map[string]string{testTenant + ".json": "legacy session"})
+	storeDir := t.TempDir()
+	t.Setenv(authorizer.EnvStoreDir, storeDir)
+
+	if _, err := authorizer.NewAppDataStoreForTest(testTenant); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, dir := range []string{storeDir, stateDir} {
+		if _, err := os.Stat(filepath.Join(dir, testTenant+".json")); !os.IsNotExist(err) {
+			t.Fatalf("expected no session migrated to %s, got %v", dir, err)
+		}
+	}
+	if content := mustReadFile(t, filepath.Join(legacyDir, testTenant+".json")); string(content) != "legacy session" {
+		t.Fatalf("expected the legacy session to be left alone, got %q", content)
+	}
+}
+
+func TestFileSystemStorePermissions(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("unix permissions are not enforced on windows")
+	}
+
+	dir := filepath.Join(t.TempDir(), "store")
+	store := newFileSystemStore(t, testTenant, dir)
+	if err := store.Save(authorizer.Authentication{User: authorizer.User{Sub: "auth0|alice"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	if info, err := os.Stat(dir); err != nil || info.Mode().Perm() != 0700 {
+		t.Fatalf("expected the store directory to be private, got %v, %v", info, err)
+	}
+	if info, err := os.Stat(filepath.Join(dir, testTenant+".json")); err != nil || info.Mode().Perm() != 0600 {
+		t.Fatalf("expected the authentication file to be private, got %v, %v", info, err)
+	}
+}
@@ -0,0 +1,192 @@
+package auth0cliauthorizer
+
+import (
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// NewStoreFactoryFromURL builds a store factory from a URL, so that the backend
+// can be chosen in configuration:
+//
+//	file:///path                             files in the given directory
+//	memory://                                in memory, lost when the process exits
+//	keyring://service                        the OS keyring, under the given service name
+//	exec://helper?arg=a&arg=b                an external helper, see NewExecStoreFactory
+//	encrypted+file:///path?keyfile=/key/path encrypted files, see NewEncryptedFileStoreFactory
+func NewStoreFactoryFromURL(rawURL string) (StoreFactory, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid store URL")
+	}
+
+	switch u.Scheme {
+	case "file":
+		dir, err := storeURLPath(u)
+		if err != nil {
+			return nil, err
+		}
+		return func(key string) (Store, error) {
+			return newFileSystemStore(key, dir, nil, &loggerWrapper{underlying: &noOpLogger{}})
+		}, nil
+
+	case "memory":
+		return newMemoryStoreFactory(), nil
+
+	case "keyring":
+		return NewKeyringStoreFactory(u.Host), nil
+
+	case "exec":
+		command := u.Host + u.Path
+		if command == "" {
+			return nil, errors.New("missing command in exec store URL")
+		}
+		return NewExecStoreFactory(command, u.Query()["arg"]...), nil
+
+	case "encrypted+file":
+		dir, err := storeURLPath(u)
+		if err != nil {
+			return nil, err
+		}
+		keyFile := u.Query().Get("keyfile")
+		if keyFile == "" {
+			return nil, errors.New("missing keyfile in encrypted file store URL")
+		}
+		secret, err := os.ReadFile(keyFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "error reading the store key file")
+		}
+		return NewEncryptedFileStoreFactory(dir, secret), nil
+
+	default:
+		return nil, errors.Errorf("unsupported store URL scheme %q", u.Scheme)
+	}
+}
+
+// storeBuilderFromURL keeps the session metadata for file stores,
+// which the plain factory does not know about.
+func storeBuilderFromURL(rawURL string) (storeBuilder, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid store URL")
+	}
+
+	if u.Scheme == "file" {
+		dir, err := storeURLPath(u)
+		if err != nil {
+			return nil, err
+		}
+		return func(hash string, metadata SessionMetadata, logger *loggerWrapper) (Store, error) {
+			return newFileSystemStore(hash, dir, &metadata, logger)
+		}, nil
+	}
+
+	factory, err := NewStoreFactoryFromURL(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	return func(hash string, _ SessionMetadata, _ *loggerWrapper) (Store, error) {
+		return factory(hash)
+	}, nil
+}
+
+func storeURLPath(u *url.URL) (string, error) {
+	if u.Host != "" && u.Host != "localhost" {
+		return "", errors.Errorf("store URL %s must have an absolute path", u.Redacted())
+	}
+	if u.Path == "" {
+		return "", errors.Errorf("missing path in store URL %s", u.Redacted())
+	}
+
+	p := u.Path
+	// file:///C:/dir on Windows
+	if len(p) > 2 && p[0] == '/' && p[2] == ':' {
+		p = p[1:]
+	}
+	return filepath.FromSlash(p), nil
+}
+
+type optionStoreURL struct {
+	url         string
+	minDuration time.Duration
+}
+
+// WithStoreURL selects the store with a URL, see NewStoreFactoryFromURL.
+func WithStoreURL(url string, minDuration time.Duration) Option {
+	return &optionStoreURL{
+		url:         url,
+		minDuration: minDuration,
+	}
+}
+
+func (o *optionStoreURL) apply(target *DefaultImpl) error {
+	builder, err := storeBuilderFromURL(o.url)
+	if err != nil {
+		return err
+	}
+	target.storeRestoreMinDuration = o.minDuration
+	target.storeBuilder = builder
+	return nil
+}
+
+type memoryStore struct {
+	mu             sync.Mutex
+	authentication *Authentication
+}
+
+var _ Store = &memoryStore{}
+
+// newMemoryStoreFactory returns the same store for the same key,
+// as the factory is invoked on every access when used as secure store.
+func newMemoryStoreFactory() StoreFactory {
+	var mu sync.Mutex
+	stores := make(map[string]*memoryStore)
+
+	return func(key string) (Store, error) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if _, ok := stores[key]; !ok {
+			stores[key] = &memoryStore{}
+		}
+		return stores[key], nil
+	}
+}
+
+func (m *memoryStore) Save(authentication Authentication) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.authentication = copyAuthentication(&authentication)
+	return nil
+}
+
+func (m *memoryStore) Load() (*Authentication, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.authentication == nil {
+		return nil, nil
+	}
+	return copyAuthentication(m.authentication), nil
+}
+
+func (m *memoryStore) Clear() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.authentication = nil
+	return nil
+}
+
+func copyAuthentication(authentication *Authentication) *Authentication {
+	copied := *authentication
+	if authentication.User.Permissions != nil {
+		copied.User.Permissions = append([]string{}, authentication.User.Permissions...)
+	}
+	return &copied
+}
@@ -0,0 +1,211 @@
+package auth0cliauthorizer
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// storeWatchPollInterval is used when the store can't be watched for changes.
+	storeWatchPollInterval = 2 * time.Second
+	// storeWatchDebounce groups the several file events a single save produces.
+	storeWatchDebounce = 100 * time.Millisecond
+)
+
+var errStoreWatchNotSupported = errors.New("watching the store is not supported on this platform")
+
+// StoreChangeCallback receives the authentication found in the store after a change,
+// nil when it was cleared.
+type StoreChangeCallback func(authentication *Authentication)
+
+// watchableStore is implemented by stores kept in files,
+// whose changes can be watched instead of polled.
+type watchableStore interface {
+	watchTarget() (dir string, match func(name string) bool)
+}
+
+// StoreWatcher keeps the authentication in sync with the store, which other processes
+// may rewrite (e.g. a login from another terminal) or clear (a logout).
+type StoreWatcher struct {
+	authorizer *DefaultImpl
+
+	mu             sync.Mutex
+	authentication *Authentication
+	subscribers    map[int]StoreChangeCallback
+	nextID         int
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// WatchStore starts watching the store until ctx is done or Close is called.
+// Changes are noticed with inotify on Linux and by polling elsewhere.
+func (a *DefaultImpl) WatchStore(ctx context.Context) (*StoreWatcher, error) {
+	if a.store == nil {
+		return nil, errors.New("missing store implementation")
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	w := &StoreWatcher{
+		authorizer:  a,
+		subscribers: make(map[int]StoreChangeCallback),
+		cancel:      cancel,
+		done:        make(chan struct{}),
+	}
+
+	// watching before the first load, so that no change goes unnoticed
+	changed := make(chan struct{}, 1)
+	w.watch(ctx, changed)
+
+	loaded, err := a.store.Load()
+	if err != nil {
+		cancel()
+		return nil, errors.Wrap(err, "error loading authentication from store")
+	}
+	w.authentication = loaded
+
+	go w.run(ctx, changed)
+
+	return w, nil
+}
+
+// Authentication returns the authentication currently in the store, nil if there is none.
+// Tokens are not refreshed: use Authorize for that.
+func (w *StoreWatcher) Authentication() *Authentication {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.authentication == nil {
+		return nil
+	}
+	copied := *w.authentication
+	return &copied
+}
+
+// Subscribe registers a callback invoked on every change, from the watcher goroutine.
+// The returned function removes it.
+func (w *StoreWatcher) Subscribe(callback StoreChangeCallback) func() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	id := w.nextID
+	w.nextID++
+	w.subscribers[id] = callback
+
+	return func() {
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		delete(w.subscribers, id)
+	}
+}
+
+// Close stops watching and waits for the watcher goroutine to exit.
+func (w *StoreWatcher) Close() {
+	w.cancel()
+	<-w.done
+}
+
+func (w *StoreWatcher) run(ctx context.Context, changed <-chan struct{}) {
+	defer close(w.done)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-changed:
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(storeWatchDebounce):
+		}
+
+		w.reload()
+	}
+}
+
+func (w *StoreWatcher) watch(ctx context.Context, changed chan<- struct{}) {
+	notify := func() {
+		select {
+		case changed <- struct{}{}:
+		default:
+		}
+	}
+
+	watching := false
+	if watchable, ok := w.authorizer.store.(watchableStore); ok {
+		if dir, match := watchable.watchTarget(); dir != "" {
+			err := watchDirectory(ctx, dir, func(name string) {
+				if match(name) {
+					notify()
+				}
+			}, func(err error) {
+				w.authorizer.logger.Warningf("stopped watching the store, falling back to polling: %v", err)
+				go w.poll(ctx, notify)
+			})
+			if err != nil {
+				w.authorizer.logger.Debugf("falling back to polling the store: %v", err)
+			} else {
+				watching = true
+			}
+		}
+	}
+	if !watching {
+		go w.poll(ctx, notify)
+	}
+}
+
+func (w *StoreWatcher) poll(ctx context.Context, notify func()) {
+	ticker := time.NewTicker(storeWatchPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			notify()
+		}
+	}
+}
+
+func (w *StoreWatcher) reload() {
+	loaded, err := w.authorizer.store.Load()
+	if err != nil {
+		w.authorizer.logger.Warningf("error reloading authentication from store: %v", err)
+		return
+	}
+
+	w.mu.Lock()
+	if reflect.DeepEqual(loaded, w.authentication) {
+		w.mu.Unlock()
+		return
+	}
+	w.authentication = loaded
+
+	subscribers := make([]StoreChangeCallback, 0, len(w.subscribers))
+	for _, callback := range w.subscribers {
+		subscribers = append(subscribers, callback)
+	}
+	w.mu.Unlock()
+
+	if loaded == nil {
+		w.authorizer.logger.Debug("authentication was removed from store")
+	} else {
+		w.authorizer.logger.Debugf("authentication in store changed, now for %s", loaded.User.Email)
+	}
+
+	for _, callback := range subscribers {
+		if loaded == nil {
+			callback(nil)
+			continue
+		}
+		copied := *loaded
+		callback(&copied)
+	}
+}
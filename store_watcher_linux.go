@@ -0,0 +1,70 @@
+//go:build linux
+// +build linux
+
+package auth0cliauthorizer
+
+import (
+	"bytes"
+	"context"
+	"unsafe"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+)
+
+// watchDirectory calls onEvent with the name of every file created, written, moved or removed in dir,
+// until ctx is done. onError is called if watching stops before that.
+func watchDirectory(ctx context.Context, dir string, onEvent func(name string), onError func(err error)) error {
+	fd, err := unix.InotifyInit1(unix.IN_CLOEXEC | unix.IN_NONBLOCK)
+	if err != nil {
+		return errors.Wrap(err, "error initializing inotify")
+	}
+
+	mask := uint32(unix.IN_CREATE | unix.IN_CLOSE_WRITE | unix.IN_MOVED_FROM | unix.IN_MOVED_TO | unix.IN_DELETE)
+	if _, err = unix.InotifyAddWatch(fd, dir, mask); err != nil {
+		unix.Close(fd)
+		return errors.Wrapf(err, "error watching %s", dir)
+	}
+
+	go func() {
+		defer unix.Close(fd)
+
+		buffer := make([]byte, 64*(unix.SizeofInotifyEvent+unix.NAME_MAX+1))
+		for ctx.Err() == nil {
+			// a timeout, to check ctx now and then
+			n, err := unix.Poll([]unix.PollFd{{Fd: int32(fd), Events: unix.POLLIN}}, 500)
+			if err != nil && err != unix.EINTR {
+				onError(errors.Wrap(err, "error polling inotify"))
+				return
+			}
+			if n <= 0 {
+				continue
+			}
+
+			read, err := unix.Read(fd, buffer)
+			if err != nil {
+				if err == unix.EAGAIN || err == unix.EINTR {
+					continue
+				}
+				onError(errors.Wrap(err, "error reading inotify events"))
+				return
+			}
+
+			for offset := 0; offset+unix.SizeofInotifyEvent <= read; {
+				event := (*unix.InotifyEvent)(unsafe.Pointer(&buffer[offset]))
+				nameStart := offset + unix.SizeofInotifyEvent
+				nameEnd := nameStart + int(event.Len)
+				if nameEnd > read {
+					break
+				}
+
+				if name := string(bytes.TrimRight(buffer[nameStart:nameEnd], "\x00")); name != "" {
+					onEvent(name)
+				}
+				offset = nameEnd
+			}
+		}
+	}()
+
+	return nil
+}
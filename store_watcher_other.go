@@ -0,0 +1,10 @@
+//go:build !linux
+// +build !linux
+
+package auth0cliauthorizer
+
+import "context"
+
+func watchDirectory(_ context.Context, _ string, _ func(name string), _ func(err error)) error {
+	return errStoreWatchNotSupported
+}
@@ -0,0 +1,63 @@
+package auth0cliauthorizer
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestWatchStore(t *testing.T) {
+	f := newFakeAuth0(t)
+	a := newTestAuthorizer(t, f, "https://api", WithFileSystemStore(t.TempDir(), 0))
+
+	watcher, err := a.WatchStore(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer watcher.Close()
+	if watcher.Authentication() != nil {
+		t.Fatal("expected no authentication in an empty store")
+	}
+
+	changes := make(chan *Authentication, 10)
+	watcher.Subscribe(func(authentication *Authentication) {
+		changes <- authentication
+	})
+
+	nextChange := func() *Authentication {
+		t.Helper()
+		select {
+		case authentication := <-changes:
+			return authentication
+		case <-time.After(3 * storeWatchPollInterval):
+			t.Fatal("expected a change to be noticed")
+			return nil
+		}
+	}
+
+	// a login from another process
+	err = a.store.Save(Authentication{
+		User:   User{Sub: f.sub, Email: "alice@example.com"},
+		Tokens: Tokens{AccessToken: "access-token", RefreshToken: "refresh-token"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if authentication := nextChange(); authentication == nil || authentication.User.Email != "alice@example.com" {
+		t.Fatalf("expected the login to be noticed, got %+v", authentication)
+	}
+	if authentication := watcher.Authentication(); authentication == nil || authentication.Tokens.AccessToken != "access-token" {
+		t.Fatalf("expected the watcher to hold the new authentication, got %+v", authentication)
+	}
+
+	// and a logout
+	if err = a.store.Clear(); err != nil {
+		t.Fatal(err)
+	}
+	if authentication := nextChange(); authentication != nil {
+		t.Fatalf("expected the logout to be noticed, got %+v", authentication)
+	}
+	if watcher.Authentication() != nil {
+		t.Fatal("expected the watcher to hold no authentication after the logout")
+	}
+}
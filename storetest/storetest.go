@@ -0,0 +1,211 @@
+// Package storetest checks that a Store implementation behaves like the built-in ones.
+package storetest
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	authorizer "github.com/fabiofenoglio/auth0-cli-authorizer"
+)
+
+// Factory returns a new, empty store. It is invoked once per check.
+type Factory func(t *testing.T) authorizer.Store
+
+const concurrentSaves = 16
+
+// Run checks the Save, Load and Clear semantics of the stores built by factory:
+//
+//   - Load on an empty store returns nil and no error
+//   - Clear is idempotent
+//   - a saved authentication is loaded back with every field preserved
+//   - concurrent Save and Load calls are safe
+func Run(t *testing.T, factory Factory) {
+	t.Helper()
+
+	t.Run("LoadEmpty", func(t *testing.T) {
+		testLoadEmpty(t, factory(t))
+	})
+	t.Run("ClearIdempotent", func(t *testing.T) {
+		testClearIdempotent(t, factory(t))
+	})
+	t.Run("RoundTrip", func(t *testing.T) {
+		testRoundTrip(t, factory(t))
+	})
+	t.Run("Overwrite", func(t *testing.T) {
+		testOverwrite(t, factory(t))
+	})
+	t.Run("ConcurrentSave", func(t *testing.T) {
+		testConcurrentSave(t, factory(t))
+	})
+}
+
+func testLoadEmpty(t *testing.T, store authorizer.Store) {
+	loaded, err := store.Load()
+	if err != nil {
+		t.Fatalf("Load on an empty store returned an error: %v", err)
+	}
+	if loaded != nil {
+		t.Fatalf("Load on an empty store returned %+v, expected nil", loaded)
+	}
+}
+
+func testClearIdempotent(t *testing.T, store authorizer.Store) {
+	if err := store.Clear(); err != nil {
+		t.Fatalf("Clear on an empty store returned an error: %v", err)
+	}
+
+	mustSave(t, store, Authentication("clear"))
+
+	for i := 0; i < 2; i++ {
+		if err := store.Clear(); err != nil {
+			t.Fatalf("Clear #%d returned an error: %v", i+1, err)
+		}
+	}
+
+	loaded, err := store.Load()
+	if err != nil {
+		t.Fatalf("Load after Clear returned an error: %v", err)
+	}
+	if loaded != nil {
+		t.Fatalf("Load after Clear returned %+v, expected nil", loaded)
+	}
+}
+
+func testRoundTrip(t *testing.T, store authorizer.Store) {
+	saved := Authentication("round-trip")
+	mustSave(t, store, saved)
+
+	loaded := mustLoad(t, store)
+	assertEqual(t, saved, *loaded)
+}
+
+func testOverwrite(t *testing.T, store authorizer.Store) {
+	mustSave(t, store, Authentication("first"))
+
+	second := Authentication("second")
+	mustSave(t, store, second)
+
+	loaded := mustLoad(t, store)
+	assertEqual(t, second, *loaded)
+}
+
+func testConcurrentSave(t *testing.T, store authorizer.Store) {
+	saved := make([]authorizer.Authentication, concurrentSaves)
+	for i := range saved {
+		saved[i] = Authentication("concurrent")
+		saved[i].Tokens.AccessToken = fmt.Sprintf("access-token-%d", i)
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 2*concurrentSaves)
+
+	for i := range saved {
+		wg.Add(2)
+		go func(authentication authorizer.Authentication) {
+			defer wg.Done()
+			if err := store.Save(authentication); err != nil {
+				errs <- fmt.Errorf("concurrent Save returned an error: %w", err)
+			}
+		}(saved[i])
+		go func() {
+			defer wg.Done()
+			if _, err := store.Load(); err != nil {
+				errs <- fmt.Errorf("Load during concurrent saves returned an error: %w", err)
+			}
+		}()
+	}
+
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+	if t.Failed() {
+		return
+	}
+
+	loaded := mustLoad(t, store)
+	for _, candidate := range saved {
+		if candidate.Tokens.AccessToken == loaded.Tokens.AccessToken {
+			assertEqual(t, candidate, *loaded)
+			return
+		}
+	}
+	t.Fatalf("Load after concurrent saves returned %q, which was never saved", loaded.Tokens.AccessToken)
+}
+
+// Authentication returns an authentication with every field set,
+// the subject derived from the given name.
+func Authentication(name string) authorizer.Authentication {
+	authentication := authorizer.Authentication{
+		User: authorizer.User{
+			Nickname:            name,
+			Name:                "Name " + name,
+			Picture:             "https://example.com/" + name + ".png",
+			Email:               name + "@example.com",
+			EmailVerified:       true,
+			Sub:                 "auth0|" + name,
+			GivenName:           "Given",
+			FamilyName:          "Family",
+			MiddleName:          "Middle",
+			PreferredUsername:   "preferred-" + name,
+			Profile:             "https://example.com/profile/" + name,
+			Website:             "https://example.com",
+			Gender:              "other",
+			Birthdate:           "2000-01-01",
+			Zoneinfo:            "Europe/Rome",
+			Locale:              "it-IT",
+			PhoneNumber:         "+390000000000",
+			PhoneNumberVerified: true,
+			UpdatedAt:           "2022-01-01T00:00:00.000Z",
+			Permissions:         []string{"read:" + name, "write:" + name},
+		},
+		Tokens: authorizer.Tokens{
+			AccessToken:  "access-token-" + name,
+			RefreshToken: "refresh-token-" + name,
+			IdToken:      "id-token-" + name,
+			ExpiresAt:    time.Date(2030, 1, 2, 3, 4, 5, 6000, time.UTC),
+		},
+	}
+	authentication.User.Address.Country = "IT"
+	return authentication
+}
+
+func mustSave(t *testing.T, store authorizer.Store, authentication authorizer.Authentication) {
+	t.Helper()
+	if err := store.Save(authentication); err != nil {
+		t.Fatalf("Save returned an error: %v", err)
+	}
+}
+
+func mustLoad(t *testing.T, store authorizer.Store) *authorizer.Authentication {
+	t.Helper()
+	loaded, err := store.Load()
+	if err != nil {
+		t.Fatalf("Load returned an error: %v", err)
+	}
+	if loaded == nil {
+		t.Fatal("Load returned nil after Save")
+	}
+	return loaded
+}
+
+func assertEqual(t *testing.T, expected, actual authorizer.Authentication) {
+	t.Helper()
+
+	if !expected.Tokens.ExpiresAt.Equal(actual.Tokens.ExpiresAt) {
+		t.Errorf("ExpiresAt: expected %v, got %v", expected.Tokens.ExpiresAt, actual.Tokens.ExpiresAt)
+	}
+	expected.Tokens.ExpiresAt = time.Time{}
+	actual.Tokens.ExpiresAt = time.Time{}
+
+	if !reflect.DeepEqual(expected.User, actual.User) {
+		t.Errorf("User was not preserved:\nexpected %+v\ngot      %+v", expected.User, actual.User)
+	}
+	if !reflect.DeepEqual(expected.Tokens, actual.Tokens) {
+		t.Errorf("Tokens were not preserved:\nexpected %+v\ngot      %+v", expected.Tokens, actual.Tokens)
+	}
+}
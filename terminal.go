@@ -0,0 +1,52 @@
+package auth0cliauthorizer
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+const (
+	ansiClearLine   = "\r\033[K"
+	ansiClearScreen = "\033[J"
+	// black on white, whatever the theme of the terminal
+	ansiBlackOnWhite = "\033[30;47m"
+	ansiReset        = "\033[0m"
+)
+
+func isTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	if os.Getenv("TERM") == "dumb" {
+		return false
+	}
+	return isCharDevice(f)
+}
+
+func isCharDevice(f *os.File) bool {
+	fi, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return fi.Mode()&os.ModeCharDevice != 0
+}
+
+func ansiCursorUp(lines int) string {
+	if lines <= 0 {
+		return ""
+	}
+	return fmt.Sprintf("\033[%dA", lines)
+}
+
+func formatRemaining(d time.Duration) string {
+	if d < 0 {
+		d = 0
+	}
+	d = d.Truncate(time.Second)
+	minutes := int(d / time.Minute)
+	seconds := int((d % time.Minute) / time.Second)
+	return fmt.Sprintf("%02d:%02d", minutes, seconds)
+}